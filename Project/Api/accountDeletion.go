@@ -0,0 +1,298 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Dzdrgl/redis-Api/models"
+	"github.com/go-redis/redis"
+	"github.com/gorilla/mux"
+)
+
+// Deletion jobs live in deletion:<id> and are queued in the "deletions" sorted set
+// scored by the time they may run. Each step records its progress in the job so a
+// crashed or interrupted purge continues where it stopped.
+const (
+	deletionStepFriends  = "friends"
+	deletionStepRequests = "requests"
+	deletionStepSessions = "sessions"
+	deletionStepAccount  = "account"
+
+	deletionScanBatch = 100
+)
+
+var (
+	ErrAccountPendingDeletion = errors.New("Account is scheduled for deletion")
+	ErrRestoreFailed          = errors.New("Invalid credentials or the account can't be restored")
+)
+
+func (h *Handler) HandleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	log.Println("DeleteAccount - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var confirm models.PasswordConfirm
+	if err := json.NewDecoder(r.Body).Decode(&confirm); err != nil {
+		log.Printf("DeleteAccount - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	if !h.verifyPassword(h.FetchUserFieldWithID(currentUser.ID, "password"), confirm.Password) {
+		errorResponse(w, http.StatusUnauthorized, ErrInvalidCredentials.Error())
+		return
+	}
+	purgeAt, err := h.ScheduleAccountDeletion(currentUser.ID)
+	if err != nil {
+		log.Printf("DeleteAccount - %v", err)
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: deletionResult(purgeAt)})
+}
+
+func (h *Handler) HandleAdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	log.Println("AdminDeleteUser - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	userID := mux.Vars(r)["id"]
+	if h.FetchUserFieldWithID(userID, "id") == "" {
+		errorResponse(w, http.StatusNotFound, IDNotFound)
+		return
+	}
+	purgeAt, err := h.ScheduleAccountDeletion(userID)
+	if err != nil {
+		log.Printf("AdminDeleteUser - %v", err)
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: deletionResult(purgeAt)})
+}
+
+func (h *Handler) HandleRestoreAccount(w http.ResponseWriter, r *http.Request) {
+	log.Println("RestoreAccount - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var creds models.LoginInfo
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		log.Printf("RestoreAccount - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	ip := h.clientIP(r)
+	if err := h.checkLoginAllowed(creds.Username, ip); err != nil {
+		errorResponse(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	userID := h.GetUserIDWithUsername(creds.Username)
+	hashedPass := h.dummyHash
+	if userID != "" {
+		hashedPass = h.FetchUserFieldWithID(userID, "password")
+	}
+	// Wrong passwords and accounts that can't be restored get the same answer so the
+	// endpoint tells a guesser nothing that the login limiter would not.
+	if !h.verifyPassword(hashedPass, creds.Password) || userID == "" {
+		h.recordLoginFailure(creds.Username, ip)
+		errorResponse(w, http.StatusUnauthorized, ErrRestoreFailed.Error())
+		return
+	}
+	h.clearLoginFailures(creds.Username)
+	if err := h.RestoreAccount(userID); err != nil {
+		log.Printf("RestoreAccount - user %s: %v", userID, err)
+		errorResponse(w, http.StatusUnauthorized, ErrRestoreFailed.Error())
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: "Account restored"})
+}
+
+func deletionResult(purgeAt time.Time) map[string]interface{} {
+	if purgeAt.IsZero() {
+		return map[string]interface{}{"message": "Account deleted"}
+	}
+	return map[string]interface{}{
+		"message": "Account scheduled for deletion",
+		"purgeat": purgeAt.Format("2006-01-02T15:04:05"),
+	}
+}
+
+// ScheduleAccountDeletion signs the user out and queues the purge. Without a grace
+// period the purge runs right away and the returned time is zero.
+func (h *Handler) ScheduleAccountDeletion(userID string) (time.Time, error) {
+	now := time.Now()
+	purgeAt := now.Add(h.config.AccountDeletionGrace)
+	err := h.client.HMSet("deletion:"+userID, map[string]interface{}{
+		"user_id":      userID,
+		"username":     h.FetchUserFieldWithID(userID, "username"),
+		"requested_at": now.Unix(),
+		"purge_at":     purgeAt.Unix(),
+		"step":         deletionStepFriends,
+		"cursor":       0,
+	}).Err()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := h.UpdateUserField(userID, "deletion_at", strconv.FormatInt(purgeAt.Unix(), 10)); err != nil {
+		return time.Time{}, err
+	}
+	if err := h.RevokeUserTokens(userID); err != nil {
+		return time.Time{}, err
+	}
+	if err := h.client.ZAdd("deletions", redis.Z{Member: userID, Score: float64(purgeAt.Unix())}).Err(); err != nil {
+		return time.Time{}, err
+	}
+	if h.config.AccountDeletionGrace <= 0 {
+		return time.Time{}, h.PurgeAccount(userID)
+	}
+	return purgeAt, nil
+}
+
+// RestoreAccount cancels a deletion that is still inside its grace period.
+func (h *Handler) RestoreAccount(userID string) error {
+	job := h.client.HGetAll("deletion:" + userID).Val()
+	if job["user_id"] == "" {
+		return errors.New("Account is not scheduled for deletion")
+	}
+	if job["step"] != deletionStepFriends || job["cursor"] != "0" {
+		return errors.New("Account deletion is already in progress")
+	}
+	h.client.ZRem("deletions", userID)
+	h.client.Del("deletion:" + userID)
+	return h.client.HDel("user:"+userID, "deletion_at").Err()
+}
+
+// PurgeDueAccounts runs every deletion whose grace period is over.
+func (h *Handler) PurgeDueAccounts() {
+	due, err := h.client.ZRangeByScore("deletions", redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		log.Printf("PurgeDueAccounts - %v", err)
+		return
+	}
+	for _, userID := range due {
+		if err := h.PurgeAccount(userID); err != nil {
+			log.Printf("PurgeDueAccounts - user %s: %v", userID, err)
+		}
+	}
+}
+
+// RunDeletionWorker purges due accounts every interval. It is meant to run in its own goroutine.
+func (h *Handler) RunDeletionWorker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		h.PurgeDueAccounts()
+		<-ticker.C
+	}
+}
+
+// PurgeAccount removes every trace of the user, resuming from the last recorded step.
+func (h *Handler) PurgeAccount(userID string) error {
+	key := "deletion:" + userID
+	job := h.client.HGetAll(key).Val()
+	if job["user_id"] == "" {
+		h.client.ZRem("deletions", userID)
+		return errors.New("Deletion job not found")
+	}
+	step := job["step"]
+	if step == deletionStepFriends {
+		if err := h.purgeFriends(userID); err != nil {
+			return err
+		}
+		step = deletionStepRequests
+		h.client.HSet(key, "step", step)
+	}
+	if step == deletionStepRequests {
+		if err := h.purgeRequests(userID, job["cursor"]); err != nil {
+			return err
+		}
+		step = deletionStepSessions
+		h.client.HSet(key, "step", step)
+	}
+	if step == deletionStepSessions {
+		if err := h.RevokeUserTokens(userID); err != nil {
+			return err
+		}
+		step = deletionStepAccount
+		h.client.HSet(key, "step", step)
+	}
+	if err := h.purgeAccountKeys(userID, job["username"]); err != nil {
+		return err
+	}
+	log.Printf("PurgeAccount - user %s deleted", userID)
+	return nil
+}
+
+func (h *Handler) purgeFriends(userID string) error {
+	friends, err := h.client.ZRange("friends:"+userID, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for _, friendID := range friends {
+		if err := h.client.ZRem("friends:"+friendID, userID).Err(); err != nil {
+			return err
+		}
+	}
+	return h.client.Del("friends:" + userID).Err()
+}
+
+// purgeRequests drops the user's inbox and withdraws requests the user sent. Sent
+// requests have no reverse index, so every inbox is scanned and the cursor saved per batch.
+func (h *Handler) purgeRequests(userID, cursorVal string) error {
+	if err := h.client.Del("requests:" + userID).Err(); err != nil {
+		return err
+	}
+	cursor, _ := strconv.ParseUint(cursorVal, 10, 64)
+	for {
+		keys, next, err := h.client.Scan(cursor, "requests:*", deletionScanBatch).Result()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := h.client.ZRem(key, userID).Err(); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+		h.client.HSet("deletion:"+userID, "cursor", cursor)
+	}
+}
+
+// purgeAccountKeys deletes the user's own keys in one transaction.
+func (h *Handler) purgeAccountKeys(userID, username string) error {
+	_, err := h.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		if username != "" && h.GetUserIDWithUsername(username) == userID {
+			pipe.Del(usernameKey(username))
+		}
+		for _, key := range h.scoreKeys() {
+			pipe.ZRem(key, userID)
+		}
+		pipe.ZRem(sanctionedKey, userID)
+		pipe.SRem(bannedUsersKey, userID)
+		if user := h.FetchUserInfoWithID(userID); user.ID != "" {
+			for _, member := range searchTerms(user) {
+				pipe.ZRem(searchIndexKey, member)
+			}
+		}
+		pipe.Del("user:"+userID, "sessions:"+userID, "recovery:"+userID, "totp_pending:"+userID, "matches:"+userID, "usernames:"+userID, "blocked:"+userID, "sanctions:"+userID)
+		if codeHash := h.client.Get("reset_user:" + userID).Val(); codeHash != "" {
+			pipe.Del("reset:" + codeHash)
+		}
+		pipe.Del("reset_user:" + userID)
+		pipe.Del("deletion:" + userID)
+		pipe.ZRem("deletions", userID)
+		return nil
+	})
+	return err
+}
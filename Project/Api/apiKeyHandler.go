@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dzdrgl/redis-Api/models"
+	"github.com/gorilla/mux"
+)
+
+const (
+	ScopeMatchWrite      = "match:write"
+	ScopeLeaderboardRead = "leaderboard:read"
+
+	apiKeyPrefix = "ak_"
+)
+
+var apiKeyScopes = []string{ScopeMatchWrite, ScopeLeaderboardRead}
+
+var ErrInvalidAPIKey = errors.New("Invalid API key")
+
+// APIKeyMiddleware accepts an X-API-Key header carrying the given scope in place of a user
+// token. Requests without the header go through AuthMiddleware as usual.
+func (h *Handler) APIKeyMiddleware(next http.HandlerFunc, scope string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if key == "" {
+			h.AuthMiddleware(next)(w, r)
+			return
+		}
+		apiKey, err := h.ValidateAPIKey(key)
+		if err != nil {
+			errorResponse(w, http.StatusUnauthorized, "Authentication failed")
+			return
+		}
+		if !containsString(apiKey.Scopes, scope) {
+			log.Printf("APIKeyMiddleware - key %s lacks scope %s", apiKey.ID, scope)
+			errorResponse(w, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+		serviceInfo := models.User{
+			ID:       "apikey:" + apiKey.ID,
+			Username: apiKey.Name,
+			Role:     models.RoleGameServer,
+		}
+		ctx := context.WithValue(r.Context(), "userInfo", serviceInfo)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+func (h *Handler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	log.Println("CreateAPIKey - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var keyInfo models.APIKeyInfo
+	if err := json.NewDecoder(r.Body).Decode(&keyInfo); err != nil {
+		log.Printf("CreateAPIKey - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	apiKey, err := h.CreateAPIKey(keyInfo, currentUser.ID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("CreateAPIKey - key %s issued to %s", apiKey.ID, apiKey.Name)
+	successResponse(w, models.SuccessResponse{Status: true, Result: apiKey})
+}
+
+func (h *Handler) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	log.Println("ListAPIKeys - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	keys, err := h.FetchAPIKeys()
+	if err != nil {
+		log.Printf("ListAPIKeys - Error fetching keys: %v", err)
+		errorResponse(w, http.StatusInternalServerError, "Could not retrieve API keys")
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: keys})
+}
+
+func (h *Handler) HandleRotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	log.Println("RotateAPIKey - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	apiKey, err := h.RotateAPIKey(mux.Vars(r)["kid"])
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: apiKey})
+}
+
+func (h *Handler) HandleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	log.Println("RevokeAPIKey - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	if err := h.RevokeAPIKey(mux.Vars(r)["kid"]); err != nil {
+		errorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: "API key revoked"})
+}
+
+// CreateAPIKey issues a key. Only its hash is stored, so the returned key is the
+// one and only time the secret is visible.
+func (h *Handler) CreateAPIKey(keyInfo models.APIKeyInfo, createdBy string) (*models.APIKey, error) {
+	if keyInfo.Name == "" {
+		return nil, errors.New("API key name must not be empty")
+	}
+	if len(keyInfo.Scopes) == 0 {
+		return nil, errors.New("At least one scope is required")
+	}
+	for _, scope := range keyInfo.Scopes {
+		if !containsString(apiKeyScopes, scope) {
+			return nil, fmt.Errorf("Unknown scope %s", scope)
+		}
+	}
+	int64ID, err := h.client.Incr("apikey_id").Result()
+	if err != nil {
+		return nil, err
+	}
+	id := strconv.FormatInt(int64ID, 10)
+	secret, err := h.randomToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	err = h.client.HMSet("apikey:"+id, map[string]interface{}{
+		"id":         id,
+		"name":       keyInfo.Name,
+		"scopes":     strings.Join(keyInfo.Scopes, ","),
+		"key_hash":   hashToken(secret),
+		"created_by": createdBy,
+		"created_at": now,
+	}).Err()
+	if err != nil {
+		return nil, err
+	}
+	if err := h.client.SAdd("apikeys", id).Err(); err != nil {
+		return nil, err
+	}
+	apiKey := h.fetchAPIKey(id)
+	apiKey.Key = apiKeyPrefix + id + "_" + secret
+	return apiKey, nil
+}
+
+// ValidateAPIKey checks a presented key and stamps its last use.
+func (h *Handler) ValidateAPIKey(key string) (*models.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	parts := strings.SplitN(strings.TrimPrefix(key, apiKeyPrefix), "_", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidAPIKey
+	}
+	storedHash := h.client.HGet("apikey:"+parts[0], "key_hash").Val()
+	if storedHash == "" || subtle.ConstantTimeCompare([]byte(storedHash), []byte(hashToken(parts[1]))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	h.client.HSet("apikey:"+parts[0], "last_used", time.Now().Unix())
+	return h.fetchAPIKey(parts[0]), nil
+}
+
+func (h *Handler) FetchAPIKeys() ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	ids, err := h.client.SMembers("apikeys").Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.Atoi(ids[i])
+		b, _ := strconv.Atoi(ids[j])
+		return a < b
+	})
+	for _, id := range ids {
+		if apiKey := h.fetchAPIKey(id); apiKey != nil {
+			keys = append(keys, *apiKey)
+		}
+	}
+	return keys, nil
+}
+
+// RotateAPIKey replaces the secret of a key, keeping its id and scopes. The old secret stops working at once.
+func (h *Handler) RotateAPIKey(id string) (*models.APIKey, error) {
+	apiKey := h.fetchAPIKey(id)
+	if apiKey == nil {
+		return nil, errors.New("API key not found")
+	}
+	secret, err := h.randomToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := h.client.HSet("apikey:"+id, "key_hash", hashToken(secret)).Err(); err != nil {
+		return nil, err
+	}
+	apiKey.Key = apiKeyPrefix + id + "_" + secret
+	return apiKey, nil
+}
+
+func (h *Handler) RevokeAPIKey(id string) error {
+	deleted, err := h.client.Del("apikey:" + id).Result()
+	if err != nil {
+		return err
+	} else if deleted == 0 {
+		return errors.New("API key not found")
+	}
+	return h.client.SRem("apikeys", id).Err()
+}
+
+func (h *Handler) fetchAPIKey(id string) *models.APIKey {
+	fields := h.client.HGetAll("apikey:" + id).Val()
+	if fields["id"] == "" {
+		return nil
+	}
+	return &models.APIKey{
+		ID:        fields["id"],
+		Name:      fields["name"],
+		Scopes:    strings.Split(fields["scopes"], ","),
+		CreatedBy: fields["created_by"],
+		CreatedAt: formatUnix(fields["created_at"]),
+		LastUsed:  formatUnix(fields["last_used"]),
+	}
+}
+
+func containsString(list []string, val string) bool {
+	for _, item := range list {
+		if item == val {
+			return true
+		}
+	}
+	return false
+}
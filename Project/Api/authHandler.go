@@ -0,0 +1,290 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Dzdrgl/redis-Api/models"
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	log.Println("Logout - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	if err := h.RevokeSession(currentUser.ID, currentUser.SessionID); err != nil {
+		log.Printf("Logout - Error revoking token: %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: "Logged out successfully"})
+}
+
+func (h *Handler) HandleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	log.Println("LogoutAll - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	if err := h.RevokeUserTokens(currentUser.ID); err != nil {
+		log.Printf("LogoutAll - Error revoking tokens: %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: "Logged out from all sessions"})
+}
+
+func (h *Handler) HandleRevokeUserTokens(w http.ResponseWriter, r *http.Request) {
+	log.Println("RevokeUserTokens - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	userID := mux.Vars(r)["id"]
+	if h.FetchUserFieldWithID(userID, "id") == "" {
+		errorResponse(w, http.StatusNotFound, IDNotFound)
+		return
+	}
+	if err := h.RevokeUserTokens(userID); err != nil {
+		log.Printf("RevokeUserTokens - Error revoking tokens: %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	log.Printf("RevokeUserTokens - All tokens of user %s revoked", userID)
+	successResponse(w, models.SuccessResponse{Status: true, Result: "User tokens revoked"})
+}
+
+func (h *Handler) HandleUnlockLogin(w http.ResponseWriter, r *http.Request) {
+	log.Println("UnlockLogin - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	username := h.FetchUserFieldWithID(mux.Vars(r)["id"], "username")
+	if username == "" {
+		errorResponse(w, http.StatusNotFound, IDNotFound)
+		return
+	}
+	if err := h.UnlockLogin(username); err != nil {
+		log.Printf("UnlockLogin - Error clearing lockout: %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: "Login unlocked for " + username})
+}
+
+func (h *Handler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	log.Println("RefreshToken - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var refreshInfo models.RefreshInfo
+	if err := json.NewDecoder(r.Body).Decode(&refreshInfo); err != nil {
+		log.Printf("RefreshToken - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	tokens, err := h.RefreshSession(refreshInfo.RefreshToken)
+	if err != nil {
+		log.Printf("RefreshToken - %v", err)
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: tokens})
+}
+
+func (h *Handler) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	log.Println("ListSessions - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	sessions, err := h.FetchSessions(currentUser.ID, currentUser.SessionID)
+	if err != nil {
+		log.Printf("ListSessions - Error fetching sessions: %v", err)
+		errorResponse(w, http.StatusInternalServerError, "Could not retrieve sessions")
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: sessions})
+}
+
+func (h *Handler) HandleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	log.Println("DeleteSession - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	if err := h.RevokeSession(currentUser.ID, mux.Vars(r)["sid"]); err != nil {
+		errorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: "Session closed"})
+}
+
+// FetchSessions lists the live sessions of a user, dropping index entries whose token already expired.
+func (h *Handler) FetchSessions(userID, currentSessionID string) ([]models.Session, error) {
+	sessions := []models.Session{}
+	index, err := h.client.HGetAll("sessions:" + userID).Result()
+	if err != nil {
+		return nil, err
+	}
+	for sessionID, tokenHash := range index {
+		fields := h.client.HGetAll("token:" + tokenHash).Val()
+		if fields["user_id"] == "" {
+			h.client.HDel("sessions:"+userID, sessionID)
+			continue
+		}
+		sessions = append(sessions, models.Session{
+			ID:        sessionID,
+			Device:    fields["device"],
+			IP:        fields["ip"],
+			UserAgent: fields["user_agent"],
+			CreatedAt: formatUnix(fields["created_at"]),
+			LastSeen:  formatUnix(fields["last_seen"]),
+			Current:   sessionID == currentSessionID,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		a, _ := strconv.Atoi(sessions[i].ID)
+		b, _ := strconv.Atoi(sessions[j].ID)
+		return a < b
+	})
+	return sessions, nil
+}
+
+// RevokeSession closes one session of the user and leaves the others untouched.
+func (h *Handler) RevokeSession(userID, sessionID string) error {
+	tokenHash := h.client.HGet("sessions:"+userID, sessionID).Val()
+	if tokenHash == "" {
+		return errors.New("Session not found")
+	}
+	return h.revokeTokenHash(tokenHash)
+}
+
+// RevokeToken deletes a single token and unlinks it from its owner.
+func (h *Handler) RevokeToken(token string) error {
+	if token == "" {
+		return ErrInvalidToken
+	}
+	return h.revokeTokenHash(hashToken(token))
+}
+
+func (h *Handler) revokeTokenHash(tokenHash string) error {
+	fields := h.client.HMGet("token:"+tokenHash, "user_id", "session_id").Val()
+	if err := h.client.Del("token:" + tokenHash).Err(); err != nil {
+		return err
+	}
+	userID, _ := fields[0].(string)
+	sessionID, _ := fields[1].(string)
+	if userID == "" || h.client.HGet("sessions:"+userID, sessionID).Val() != tokenHash {
+		return nil
+	}
+	return h.client.HDel("sessions:"+userID, sessionID).Err()
+}
+
+// RevokeUserTokens deletes every token issued to the user.
+func (h *Handler) RevokeUserTokens(userID string) error {
+	index, err := h.client.HGetAll("sessions:" + userID).Result()
+	if err != nil {
+		return err
+	}
+	for _, tokenHash := range index {
+		if err := h.client.Del("token:" + tokenHash).Err(); err != nil {
+			return err
+		}
+	}
+	return h.client.Del("sessions:" + userID).Err()
+}
+
+// RefreshSession trades a refresh token for a new access token and a new refresh token.
+// A refresh token that was already rotated is treated as stolen and ends the whole session.
+func (h *Handler) RefreshSession(refreshToken string) (*models.AuthTokens, error) {
+	if !h.jwtEnabled() {
+		return nil, errors.New("Refresh tokens are not enabled")
+	}
+	key := tokenKey(refreshToken)
+	fields, err := h.client.HGetAll(key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if fields["user_id"] == "" {
+		return nil, ErrInvalidToken
+	}
+	if fields["rotated_at"] != "" {
+		h.revokeReusedSession(fields["user_id"], fields["session_id"])
+		return nil, ErrRefreshTokenReused
+	}
+	userID, sessionID, err := h.ValidateToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	first, err := h.client.HSetNX(key, "rotated_at", time.Now().Unix()).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !first {
+		h.revokeReusedSession(userID, sessionID)
+		return nil, ErrRefreshTokenReused
+	}
+	newToken, err := h.rotateToken(refreshToken, fields)
+	if err != nil {
+		return nil, err
+	}
+	return h.issueTokens(userID, newToken)
+}
+
+// rotateToken copies the session data of a refresh token to a fresh token that keeps
+// the original absolute deadline, and with it the key's expiry grace. The old key stays
+// behind as a marker for reuse detection.
+func (h *Handler) rotateToken(oldToken string, fields map[string]string) (string, error) {
+	token, err := h.randomToken()
+	if err != nil {
+		return "", err
+	}
+	if h.TokenIsExist(token) {
+		return h.rotateToken(oldToken, fields)
+	}
+	newFields := map[string]interface{}{}
+	for field, value := range fields {
+		newFields[field] = value
+	}
+	delete(newFields, "rotated_at")
+	newFields["last_seen"] = time.Now().Unix()
+	if err := h.client.HMSet(tokenKey(token), newFields).Err(); err != nil {
+		return "", err
+	}
+	if ttl := h.client.TTL(tokenKey(oldToken)).Val(); ttl > 0 {
+		h.client.Expire(tokenKey(token), ttl)
+	}
+	if err := h.client.HSet("sessions:"+fields["user_id"], fields["session_id"], hashToken(token)).Err(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (h *Handler) revokeReusedSession(userID, sessionID string) {
+	log.Printf("RefreshToken - reuse detected, closing session %s of user %s", sessionID, userID)
+	h.RevokeSession(userID, sessionID)
+}
+
+func formatUnix(val string) string {
+	unix, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return ""
+	}
+	return time.Unix(unix, 0).Format("2006-01-02T15:04:05")
+}
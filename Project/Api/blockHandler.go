@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/Dzdrgl/redis-Api/models"
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) HandleBlockUser(w http.ResponseWriter, r *http.Request) {
+	log.Println("BlockUser - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var target models.User
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		log.Printf("BlockUser - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	if currentUser.ID == target.ID {
+		errorResponse(w, http.StatusBadRequest, "Can't block yourself")
+		return
+	}
+	if h.FetchUserFieldWithID(target.ID, "username") == "" {
+		errorResponse(w, http.StatusBadRequest, "User ID does not exist")
+		return
+	}
+	if err := h.BlockUser(currentUser.ID, target.ID); err != nil {
+		log.Printf("BlockUser - %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: map[string]interface{}{"message": "User blocked"}})
+}
+
+func (h *Handler) HandleUnblockUser(w http.ResponseWriter, r *http.Request) {
+	log.Println("UnblockUser - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	removed, err := h.client.SRem("blocked:"+currentUser.ID, mux.Vars(r)["id"]).Result()
+	if err != nil {
+		log.Printf("UnblockUser - %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	} else if removed == 0 {
+		errorResponse(w, http.StatusNotFound, "User is not blocked")
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: map[string]interface{}{"message": "User unblocked"}})
+}
+
+func (h *Handler) HandleListBlocked(w http.ResponseWriter, r *http.Request) {
+	log.Println("ListBlocked - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	blocked, err := h.FetchBlocked(currentUser.ID)
+	if err != nil {
+		log.Printf("ListBlocked - %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: blocked})
+}
+
+// FetchBlocked returns the id and username of every user on the user's block list.
+func (h *Handler) FetchBlocked(userID string) ([]models.User, error) {
+	ids, err := h.client.SMembers("blocked:" + userID).Result()
+	if err != nil {
+		return nil, err
+	}
+	var blocked []models.User
+	for _, id := range ids {
+		blocked = append(blocked, models.User{ID: id, Username: h.FetchUserFieldWithID(id, "username")})
+	}
+	return blocked, nil
+}
+
+// BlockUser adds target to the user's block list and drops any friendship or
+// pending request between the two.
+func (h *Handler) BlockUser(userID, targetID string) error {
+	pipe := h.client.TxPipeline()
+	pipe.SAdd("blocked:"+userID, targetID)
+	pipe.ZRem("friends:"+userID, targetID)
+	pipe.ZRem("friends:"+targetID, userID)
+	pipe.ZRem("requests:"+userID, targetID)
+	pipe.ZRem("requests:"+targetID, userID)
+	_, err := pipe.Exec()
+	return err
+}
+
+// IsBlocked reports whether either user has blocked the other.
+func (h *Handler) IsBlocked(userID, otherID string) bool {
+	return h.client.SIsMember("blocked:"+userID, otherID).Val() ||
+		h.client.SIsMember("blocked:"+otherID, userID).Val()
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Config holds the tunable settings of the API. Zero durations disable the
+// matching limit.
+type Config struct {
+	TokenAbsoluteTTL time.Duration
+	TokenIdleTTL     time.Duration
+	TokenBytes       int
+	AccessTokenTTL   time.Duration
+	// JWTActiveKey selects the key that signs new access tokens; leaving it empty
+	// keeps the opaque session tokens as bearer tokens.
+	JWTActiveKey string
+	JWTKeys      map[string]*JWTKey
+
+	LoginMaxAttempts      int
+	LoginMaxAttemptsPerIP int
+	LoginFailureWindow    time.Duration
+	LoginLockout          time.Duration
+	// TrustedProxies may set X-Forwarded-For. Requests from anyone else are keyed on
+	// their own address so the header can't be used to dodge or aim the IP lockout.
+	TrustedProxies []*net.IPNet
+
+	// AdminUsers are promoted to the admin role at startup.
+	AdminUsers []string
+
+	PasswordResetTTL time.Duration
+	// NotifierFile switches notifications from the log to this file.
+	NotifierFile string
+
+	// TOTPIssuer is the account label shown in authenticator apps.
+	TOTPIssuer string
+
+	PasswordMinLength int
+	// PasswordClasses lists the character classes a password needs: lower, upper, digit, symbol.
+	PasswordClasses []string
+
+	// PasswordHasher picks the scheme for new hashes: bcrypt or argon2id. Older
+	// hashes are upgraded on the next successful login.
+	PasswordHasher string
+	BcryptCost     int
+	Argon2Time     uint32
+	Argon2Memory   uint32
+	Argon2Threads  uint8
+
+	// AccountDeletionGrace keeps deleted accounts restorable for this long.
+	AccountDeletionGrace time.Duration
+
+	UsernameMinLength int
+	UsernameMaxLength int
+	UsernamePattern   *regexp.Regexp
+	// ReservedUsernames are compared in lowercase.
+	ReservedUsernames []string
+
+	// UsernameChangeCooldown is the minimum time between two renames of one user.
+	UsernameChangeCooldown time.Duration
+	// UsernameHoldPeriod keeps a released name reserved for its previous owner.
+	UsernameHoldPeriod time.Duration
+
+	// LeaderboardPeriodRetention keeps a closed period readable this long after the
+	// following period has ended too.
+	LeaderboardPeriodRetention time.Duration
+
+	// ReportLimit caps the reports one player can file per ReportWindow.
+	ReportLimit  int
+	ReportWindow time.Duration
+
+	// MatchHistoryLimit is how many of their latest matches each player's history keeps.
+	MatchHistoryLimit int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		TokenAbsoluteTTL: 7 * 24 * time.Hour,
+		TokenIdleTTL:     24 * time.Hour,
+		AccessTokenTTL:   15 * time.Minute,
+		TokenBytes:       32,
+		JWTKeys:          map[string]*JWTKey{},
+
+		LoginMaxAttempts:      5,
+		LoginMaxAttemptsPerIP: 20,
+		LoginFailureWindow:    15 * time.Minute,
+		LoginLockout:          15 * time.Minute,
+
+		PasswordResetTTL: 30 * time.Minute,
+		TOTPIssuer:       "redis-Api",
+
+		PasswordMinLength: 8,
+		PasswordClasses:   []string{"lower", "upper", "digit"},
+
+		PasswordHasher: "bcrypt",
+		BcryptCost:     bcrypt.DefaultCost,
+		Argon2Time:     1,
+		Argon2Memory:   64 * 1024,
+		Argon2Threads:  4,
+
+		UsernameMinLength: 3,
+		UsernameMaxLength: 20,
+		UsernamePattern:   regexp.MustCompile(`^[A-Za-z0-9_.-]+$`),
+		ReservedUsernames: []string{"admin", "administrator", "system", "root", "moderator", "support", "api"},
+
+		UsernameChangeCooldown: 30 * 24 * time.Hour,
+		UsernameHoldPeriod:     14 * 24 * time.Hour,
+
+		LeaderboardPeriodRetention: 24 * time.Hour,
+
+		ReportLimit:  5,
+		ReportWindow: time.Hour,
+
+		MatchHistoryLimit: 100,
+	}
+}
+
+// LoadConfig starts from DefaultConfig and overrides values set in the environment.
+func LoadConfig() Config {
+	config := DefaultConfig()
+	envDuration("TOKEN_ABSOLUTE_TTL", &config.TokenAbsoluteTTL)
+	envDuration("TOKEN_IDLE_TTL", &config.TokenIdleTTL)
+	config.AdminUsers = splitList(os.Getenv("ADMIN_USERS"))
+	envInt("TOKEN_BYTES", &config.TokenBytes)
+	envDuration("ACCESS_TOKEN_TTL", &config.AccessTokenTTL)
+	if err := parseJWTKeys(config.JWTKeys, "HS256", os.Getenv("JWT_HS256_KEYS")); err != nil {
+		log.Printf("Config - %v", err)
+	}
+	if err := parseJWTKeys(config.JWTKeys, "RS256", os.Getenv("JWT_RS256_KEYS")); err != nil {
+		log.Printf("Config - %v", err)
+	}
+	envInt("LOGIN_MAX_ATTEMPTS", &config.LoginMaxAttempts)
+	envInt("LOGIN_MAX_ATTEMPTS_PER_IP", &config.LoginMaxAttemptsPerIP)
+	envDuration("LOGIN_FAILURE_WINDOW", &config.LoginFailureWindow)
+	envDuration("LOGIN_LOCKOUT", &config.LoginLockout)
+	for _, proxy := range splitList(os.Getenv("TRUSTED_PROXIES")) {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			config.TrustedProxies = append(config.TrustedProxies, network)
+		} else {
+			log.Printf("Config - invalid TRUSTED_PROXIES entry %q", proxy)
+		}
+	}
+	envDuration("PASSWORD_RESET_TTL", &config.PasswordResetTTL)
+	config.NotifierFile = os.Getenv("NOTIFIER_FILE")
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		config.TOTPIssuer = issuer
+	}
+	envInt("PASSWORD_MIN_LENGTH", &config.PasswordMinLength)
+	if classes, ok := os.LookupEnv("PASSWORD_CLASSES"); ok {
+		config.PasswordClasses = splitList(classes)
+	}
+	if hasher := os.Getenv("PASSWORD_HASHER"); hasher != "" {
+		config.PasswordHasher = hasher
+	}
+	envInt("BCRYPT_COST", &config.BcryptCost)
+	if config.BcryptCost < bcrypt.MinCost || config.BcryptCost > bcrypt.MaxCost {
+		log.Printf("Config - BCRYPT_COST must be between %d and %d, using %d", bcrypt.MinCost, bcrypt.MaxCost, bcrypt.DefaultCost)
+		config.BcryptCost = bcrypt.DefaultCost
+	}
+	envUint32("ARGON2_TIME", &config.Argon2Time, 1, 1<<10)
+	envUint32("ARGON2_MEMORY", &config.Argon2Memory, 8, 4<<20)
+	threads := uint32(config.Argon2Threads)
+	envUint32("ARGON2_THREADS", &threads, 1, 255)
+	config.Argon2Threads = uint8(threads)
+	envDuration("ACCOUNT_DELETION_GRACE", &config.AccountDeletionGrace)
+	envInt("USERNAME_MIN_LENGTH", &config.UsernameMinLength)
+	envInt("USERNAME_MAX_LENGTH", &config.UsernameMaxLength)
+	if pattern := os.Getenv("USERNAME_PATTERN"); pattern != "" {
+		if compiled, err := regexp.Compile(pattern); err == nil {
+			config.UsernamePattern = compiled
+		} else {
+			log.Printf("Config - invalid USERNAME_PATTERN: %v", err)
+		}
+	}
+	if reserved := os.Getenv("RESERVED_USERNAMES"); reserved != "" {
+		for _, name := range splitList(reserved) {
+			config.ReservedUsernames = append(config.ReservedUsernames, strings.ToLower(name))
+		}
+	}
+	envDuration("USERNAME_CHANGE_COOLDOWN", &config.UsernameChangeCooldown)
+	envDuration("USERNAME_HOLD_PERIOD", &config.UsernameHoldPeriod)
+	envDuration("LEADERBOARD_PERIOD_RETENTION", &config.LeaderboardPeriodRetention)
+	envInt("REPORT_LIMIT", &config.ReportLimit)
+	envDuration("REPORT_WINDOW", &config.ReportWindow)
+	envInt("MATCH_HISTORY_LIMIT", &config.MatchHistoryLimit)
+	if config.MatchHistoryLimit < 1 {
+		log.Println("Config - MATCH_HISTORY_LIMIT must be at least 1, using 100")
+		config.MatchHistoryLimit = 100
+	}
+	config.JWTActiveKey = os.Getenv("JWT_ACTIVE_KEY")
+	if key, ok := config.JWTKeys[config.JWTActiveKey]; config.JWTActiveKey != "" && (!ok || (key.Algorithm == "RS256" && key.PrivateKey == nil)) {
+		log.Printf("Config - JWT key %s cannot sign, JWT access tokens disabled", config.JWTActiveKey)
+		config.JWTActiveKey = ""
+	}
+	return config
+}
+
+func envDuration(name string, target *time.Duration) {
+	val := os.Getenv(name)
+	if val == "" {
+		return
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		log.Printf("Config - invalid duration for %s: %v", name, err)
+		return
+	}
+	*target = d
+}
+
+func envInt(name string, target *int) {
+	val := os.Getenv(name)
+	if val == "" {
+		return
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		log.Printf("Config - invalid integer for %s: %v", name, err)
+		return
+	}
+	*target = n
+}
+
+// envUint32 reads an unsigned setting and ignores values outside [min, max].
+func envUint32(name string, target *uint32, min, max uint32) {
+	val := os.Getenv(name)
+	if val == "" {
+		return
+	}
+	n, err := strconv.ParseUint(val, 10, 32)
+	if err != nil || uint32(n) < min || uint32(n) > max {
+		log.Printf("Config - %s must be an integer between %d and %d", name, min, max)
+		return
+	}
+	*target = uint32(n)
+}
+
+func splitList(val string) []string {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
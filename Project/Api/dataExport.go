@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Dzdrgl/redis-Api/models"
+)
+
+func (h *Handler) HandleExportData(w http.ResponseWriter, r *http.Request) {
+	log.Println("ExportData - Called")
+
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	export, err := h.BuildDataExport(currentUser.ID)
+	if err != nil {
+		log.Printf("ExportData - %v", err)
+		errorResponse(w, http.StatusInternalServerError, "Could not build data export")
+		return
+	}
+	w.Header().Set(ContentType, ApplicationJSON)
+	w.Header().Set("Content-Disposition", "attachment; filename=\"user-"+currentUser.ID+"-export.json\"")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(export)
+}
+
+// BuildDataExport gathers everything stored about the user into one document.
+func (h *Handler) BuildDataExport(userID string) (*models.DataExport, error) {
+	export := &models.DataExport{
+		ExportedAt: time.Now().Format("2006-01-02T15:04:05"),
+		Profile:    h.FetchUserInfoWithID(userID),
+		MFAEnabled: h.mfaEnabled(userID),
+	}
+
+	board, err := h.FetchLeaderboard(DefaultLeaderboard)
+	if err != nil {
+		return nil, err
+	}
+	export.Score, export.Rank = h.FetchStanding(board, userID)
+
+	standings, err := h.FetchStandings(userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Standings = standings
+
+	seasonStandings, err := h.FetchSeasonStandings(userID)
+	if err != nil {
+		return nil, err
+	}
+	export.SeasonStandings = seasonStandings
+
+	friendCount := h.client.ZCard("friends:" + userID).Val()
+	if friendCount > 0 {
+		friends, err := h.BuildFriendList(models.ListInfo{Count: friendCount, Page: 1}, userID)
+		if err != nil {
+			return nil, err
+		}
+		export.Friends = friends
+	}
+
+	requestCount := h.client.ZCard("requests:" + userID).Val()
+	if requestCount > 0 {
+		requests, err := h.FetchFriendRequests(models.ListInfo{Count: requestCount, Page: 1}, userID)
+		if err != nil {
+			return nil, err
+		}
+		export.FriendRequests = requests
+	}
+
+	blocked, err := h.FetchBlocked(userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Blocked = blocked
+
+	sessions, err := h.FetchSessions(userID, "")
+	if err != nil {
+		return nil, err
+	}
+	export.Sessions = sessions
+
+	matches, err := h.FetchMatchHistory(userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Matches = matches
+
+	pastNames, err := h.FetchUsernameHistory(userID)
+	if err != nil {
+		return nil, err
+	}
+	export.PastUsernames = pastNames
+
+	reports, err := h.FetchReportsBy(userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Reports = reports
+	return export, nil
+}
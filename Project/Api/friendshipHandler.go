@@ -38,38 +38,6 @@ func (s *FriendRequestStatusType) UnmarshalJSON(b []byte) error {
 	return errors.New("invalid status value")
 }
 
-func (h *Handler) HandleSearchUser(w http.ResponseWriter, r *http.Request) {
-	log.Println("SearchUser - Called")
-	w.Header().Set(ContentType, ApplicationJSON)
-
-	var requestUser models.User
-	if err := json.NewDecoder(r.Body).Decode(&requestUser); err != nil {
-		log.Printf("HandleSearchUser - Invalid JSON input: %v", err)
-		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
-		return
-	}
-
-	user, ok := r.Context().Value("userInfo").(models.User)
-	if !ok {
-		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
-		return
-	}
-
-	if user.Username == requestUser.Username {
-		errorResponse(w, http.StatusBadRequest, "Can't search your own username")
-		return
-	}
-
-	searchedID := h.GetUserIDWithUsername(requestUser.Username)
-	if searchedID == "" {
-		log.Printf("HandleSearchUser - Username does not exist: %v", requestUser.Username)
-		errorResponse(w, http.StatusBadRequest, "Username does not exist")
-		return
-	}
-
-	successResponse(w, models.SuccessResponse{Status: true, Result: map[string]interface{}{"id": searchedID}})
-}
-
 func (h *Handler) HandleSendFriendRequest(w http.ResponseWriter, r *http.Request) {
 	log.Println("HandleSendFriendRequest - Called")
 	w.Header().Set(ContentType, ApplicationJSON)
@@ -93,7 +61,7 @@ func (h *Handler) HandleSendFriendRequest(w http.ResponseWriter, r *http.Request
 	}
 
 	targetUsername := h.FetchUserFieldWithID(requestUser.ID, "username")
-	if targetUsername == "" {
+	if targetUsername == "" || h.IsBlocked(currentUser.ID, requestUser.ID) {
 		errorResponse(w, http.StatusBadRequest, "User ID does not exist")
 		return
 	}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/Dzdrgl/redis-Api/models"
+)
+
+// JWTKey is one signing key. Keys are looked up by their kid so old keys can
+// keep verifying tokens after the active key has been rotated.
+type JWTKey struct {
+	ID         string
+	Algorithm  string
+	Secret     []byte
+	PrivateKey *rsa.PrivateKey
+	PublicKey  *rsa.PublicKey
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+type AccessClaims struct {
+	Subject   string `json:"sub"`
+	Username  string `json:"name"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (h *Handler) jwtEnabled() bool {
+	return h.config.JWTActiveKey != ""
+}
+
+// SignAccessToken issues a short-lived access token with the active key.
+func (h *Handler) SignAccessToken(user *models.User, sessionID string) (string, error) {
+	key, ok := h.config.JWTKeys[h.config.JWTActiveKey]
+	if !ok {
+		return "", errors.New("Active JWT key is not configured")
+	}
+	now := time.Now()
+	claims := AccessClaims{
+		Subject:   user.ID,
+		Username:  user.Username,
+		Role:      string(user.Role),
+		SessionID: sessionID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(h.config.AccessTokenTTL).Unix(),
+	}
+	header, err := json.Marshal(jwtHeader{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := key.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// VerifyAccessToken checks the signature and expiry locally, without touching Redis.
+func (h *Handler) VerifyAccessToken(token string) (*AccessClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	key, ok := h.config.JWTKeys[header.KeyID]
+	if !ok || key.Algorithm != header.Algorithm {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims AccessClaims
+	if err := json.Unmarshal(rawClaims, &claims); err != nil || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func (k *JWTKey) sign(input []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case "HS256":
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case "RS256":
+		if k.PrivateKey == nil {
+			return nil, fmt.Errorf("JWT key %s can only verify", k.ID)
+		}
+		digest := sha256.Sum256(input)
+		return rsa.SignPKCS1v15(rand.Reader, k.PrivateKey, crypto.SHA256, digest[:])
+	}
+	return nil, fmt.Errorf("Unsupported JWT algorithm %s", k.Algorithm)
+}
+
+func (k *JWTKey) verify(input, signature []byte) bool {
+	switch k.Algorithm {
+	case "HS256":
+		expected, _ := k.sign(input)
+		return hmac.Equal(expected, signature)
+	case "RS256":
+		digest := sha256.Sum256(input)
+		return rsa.VerifyPKCS1v15(k.PublicKey, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
+
+// parseJWTKeys reads "kid=value" pairs separated by commas. For HS256 the value is
+// the shared secret, for RS256 it is the path of a PEM private or public key.
+func parseJWTKeys(keys map[string]*JWTKey, algorithm, spec string) error {
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return fmt.Errorf("invalid JWT key entry %q", pair)
+		}
+		key := &JWTKey{ID: kv[0], Algorithm: algorithm}
+		if algorithm == "HS256" {
+			key.Secret = []byte(kv[1])
+		} else if err := key.loadRSA(kv[1]); err != nil {
+			return err
+		}
+		keys[key.ID] = key
+	}
+	return nil
+}
+
+func (k *JWTKey) loadRSA(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("no PEM data in %s", path)
+	}
+	if private, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		k.PrivateKey, k.PublicKey = private, &private.PublicKey
+		return nil
+	}
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if private, ok := parsed.(*rsa.PrivateKey); ok {
+			k.PrivateKey, k.PublicKey = private, &private.PublicKey
+			return nil
+		}
+	}
+	if parsed, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		if public, ok := parsed.(*rsa.PublicKey); ok {
+			k.PublicKey = public
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not an RSA key", path)
+}
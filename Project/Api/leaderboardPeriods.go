@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Dzdrgl/redis-Api/models"
+)
+
+// Leaderboard periods. Every board keeps its all-time scores plus one bucket per
+// day, ISO week and month. Buckets are keyed in UTC and expire one full period after
+// they close, plus LeaderboardPeriodRetention, so the previous standings stay readable.
+const (
+	PeriodAll   = "all"
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+var (
+	timedPeriods     = []string{PeriodDay, PeriodWeek, PeriodMonth}
+	ErrInvalidPeriod = errors.New("Period must be all, day, week or month")
+)
+
+// periodBounds returns the bucket name and the start and end of the period holding t.
+func periodBounds(period string, t time.Time) (string, time.Time, time.Time) {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case PeriodWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+		start := day.AddDate(0, 0, -offset)
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week), start, start.AddDate(0, 0, 7)
+	case PeriodMonth:
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start.Format("2006-01"), start, start.AddDate(0, 1, 0)
+	}
+	return day.Format("2006-01-02"), day, day.AddDate(0, 0, 1)
+}
+
+// periodBoard returns a copy of board pointing at the current or the previous bucket
+// of period. The all period returns the board itself.
+func periodBoard(board *models.Leaderboard, period string, previous bool) (*models.Leaderboard, error) {
+	if period == "" || period == PeriodAll {
+		if previous {
+			return nil, errors.New("The all-time board has no previous period")
+		}
+		return board, nil
+	}
+	if !containsString(timedPeriods, period) {
+		return nil, ErrInvalidPeriod
+	}
+	at := time.Now()
+	if previous {
+		_, start, _ := periodBounds(period, at)
+		at = start.Add(-time.Second)
+	}
+	bucket, _, _ := periodBounds(period, at)
+	windowed := *board
+	windowed.Period = period
+	windowed.Bucket = bucket
+	return &windowed, nil
+}
+
+// scoreKeys lists every board key that may hold the user's scores: the all-time boards,
+// every period bucket that has not expired yet and the season archives.
+func (h *Handler) scoreKeys() []string {
+	ids := append([]string{DefaultLeaderboard}, h.client.SMembers("leaderboards").Val()...)
+	var keys []string
+	for _, id := range ids {
+		board, err := h.FetchLeaderboard(id)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, boardKey(board))
+		buckets, err := h.matchingKeys("leaderboard:" + board.ID + ":*")
+		if err != nil {
+			log.Printf("scoreKeys - %v", err)
+		}
+		keys = append(keys, buckets...)
+	}
+	for _, season := range h.client.ZRange("seasons", 0, -1).Val() {
+		for _, boardID := range h.client.SMembers("season:" + season + ":boards").Val() {
+			keys = append(keys, boardKey(&models.Leaderboard{ID: boardID, Season: season}))
+		}
+		for _, boardID := range h.client.SMembers("season:" + season + ":preseason").Val() {
+			keys = append(keys, "season:"+season+":preseason:board:"+boardID)
+		}
+	}
+	return keys
+}
+
+// periodBoards returns the buckets a match played now counts towards, with the time
+// each bucket may expire.
+func (h *Handler) periodBoards(board *models.Leaderboard) ([]*models.Leaderboard, []time.Time) {
+	var boards []*models.Leaderboard
+	var expiries []time.Time
+	now := time.Now()
+	for _, period := range timedPeriods {
+		bucket, _, end := periodBounds(period, now)
+		_, _, nextEnd := periodBounds(period, end)
+		windowed := *board
+		windowed.Period = period
+		windowed.Bucket = bucket
+		boards = append(boards, &windowed)
+		expiries = append(expiries, nextEnd.Add(h.config.LeaderboardPeriodRetention))
+	}
+	return boards, expiries
+}
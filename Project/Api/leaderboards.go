@@ -0,0 +1,467 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Dzdrgl/redis-Api/models"
+	"github.com/go-redis/redis"
+	"github.com/gorilla/mux"
+)
+
+// DefaultLeaderboard is the board matches go to when none is named. It keeps the
+// original "leaderboard" key so existing scores stay where they are.
+const DefaultLeaderboard = "default"
+
+// Sort orders and scoring rules a board can use. points awards WinPoints, DrawPoints
+// and LossPoints per match, wins counts wins, score sums the player's own match
+// scores and best keeps the player's best single match score.
+const (
+	SortDesc = "desc"
+	SortAsc  = "asc"
+
+	ScoringPoints = "points"
+	ScoringWins   = "wins"
+	ScoringScore  = "score"
+	ScoringBest   = "best"
+)
+
+var (
+	ErrUnknownLeaderboard = errors.New("Leaderboard does not exist")
+	ErrLeaderboardExists  = errors.New("Leaderboard already exists")
+	leaderboardIDPattern  = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+	scoringRules          = []string{ScoringPoints, ScoringWins, ScoringScore, ScoringBest}
+)
+
+// addScoreScript adds a result to a board, keeping the better of the stored and the new
+// score under the best rule, and sets the expiry of period buckets. Nothing is written
+// once the board definition is gone, so matches in flight can't bring back a deleted board.
+// KEYS: board, definition (left out for the default board). ARGV: member, points,
+// scoring rule, "asc" when lower is better, unix expiry or 0.
+var addScoreScript = redis.NewScript(`
+if KEYS[2] and redis.call('EXISTS', KEYS[2]) == 0 then
+	return -1
+end
+local score = tonumber(ARGV[2])
+if ARGV[3] == 'best' then
+	local current = redis.call('ZSCORE', KEYS[1], ARGV[1])
+	if current then
+		current = tonumber(current)
+		if (ARGV[4] == 'asc' and score >= current) or (ARGV[4] ~= 'asc' and score <= current) then
+			return 0
+		end
+	end
+	redis.call('ZADD', KEYS[1], score, ARGV[1])
+elseif score ~= 0 then
+	redis.call('ZINCRBY', KEYS[1], score, ARGV[1])
+else
+	return 0
+end
+if tonumber(ARGV[5]) > 0 then
+	redis.call('EXPIREAT', KEYS[1], ARGV[5])
+end
+return 1
+`)
+
+// createBoardScript claims the board id with HSETNX and stores the definition in the
+// same step. KEYS: board definition, board set. ARGV: id, then field/value pairs.
+var createBoardScript = redis.NewScript(`
+if redis.call('HSETNX', KEYS[1], 'id', ARGV[1]) == 0 then
+	return 0
+end
+for i = 2, #ARGV, 2 do
+	redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 1])
+end
+redis.call('SADD', KEYS[2], ARGV[1])
+return 1
+`)
+
+func defaultLeaderboard() *models.Leaderboard {
+	return &models.Leaderboard{
+		ID:          DefaultLeaderboard,
+		Title:       "Global",
+		SortOrder:   SortDesc,
+		ScoringRule: ScoringPoints,
+		WinPoints:   3,
+		DrawPoints:  1,
+	}
+}
+
+func boardKey(board *models.Leaderboard) string {
+	if board.Season != "" {
+		return "season:" + board.Season + ":board:" + board.ID
+	}
+	if board.Period != "" {
+		return "leaderboard:" + board.ID + ":" + board.Period + ":" + board.Bucket
+	}
+	if board.ID == DefaultLeaderboard {
+		return "leaderboard"
+	}
+	return "leaderboard:" + board.ID
+}
+
+// FetchLeaderboard loads a board definition. An empty id means the default board.
+func (h *Handler) FetchLeaderboard(id string) (*models.Leaderboard, error) {
+	if id == "" {
+		id = DefaultLeaderboard
+	}
+	fields := h.client.HGetAll("board:" + id).Val()
+	if fields["id"] == "" {
+		if id == DefaultLeaderboard {
+			return defaultLeaderboard(), nil
+		}
+		return nil, ErrUnknownLeaderboard
+	}
+	board := &models.Leaderboard{
+		ID:          fields["id"],
+		Title:       fields["title"],
+		SortOrder:   fields["sort_order"],
+		ScoringRule: fields["scoring_rule"],
+		CreatedAt:   formatUnix(fields["created_at"]),
+	}
+	board.WinPoints, _ = strconv.Atoi(fields["win_points"])
+	board.DrawPoints, _ = strconv.Atoi(fields["draw_points"])
+	board.LossPoints, _ = strconv.Atoi(fields["loss_points"])
+	return board, nil
+}
+
+// ListLeaderboards returns the default board followed by every configured board.
+func (h *Handler) ListLeaderboards() ([]*models.Leaderboard, error) {
+	ids, err := h.client.SMembers("leaderboards").Result()
+	if err != nil {
+		return nil, err
+	}
+	defaultBoard, _ := h.FetchLeaderboard(DefaultLeaderboard)
+	boards := []*models.Leaderboard{defaultBoard}
+	for _, id := range ids {
+		if id == DefaultLeaderboard {
+			continue
+		}
+		if board, err := h.FetchLeaderboard(id); err == nil {
+			boards = append(boards, board)
+		}
+	}
+	return boards, nil
+}
+
+func validateLeaderboard(board *models.Leaderboard) error {
+	var violations []string
+	if !leaderboardIDPattern.MatchString(board.ID) {
+		violations = append(violations, "Id must be 1 to 32 lowercase letters, digits, _ or -")
+	}
+	if board.Title == "" || utf8.RuneCountInString(board.Title) > 100 {
+		violations = append(violations, "Title must be between 1 and 100 characters")
+	}
+	if board.SortOrder != SortDesc && board.SortOrder != SortAsc {
+		violations = append(violations, "Sort order must be desc or asc")
+	}
+	if !containsString(scoringRules, board.ScoringRule) {
+		violations = append(violations, "Scoring rule must be points, wins, score or best")
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Message: "Invalid leaderboard", Violations: violations}
+	}
+	return nil
+}
+
+// prepareLeaderboard fills in the defaults of a board definition and validates it.
+func prepareLeaderboard(board *models.Leaderboard) error {
+	if board.SortOrder == "" {
+		board.SortOrder = SortDesc
+	}
+	if board.ScoringRule == "" {
+		board.ScoringRule = ScoringPoints
+	}
+	if board.ScoringRule == ScoringPoints && board.WinPoints == 0 && board.DrawPoints == 0 && board.LossPoints == 0 {
+		board.WinPoints, board.DrawPoints = 3, 1
+	}
+	return validateLeaderboard(board)
+}
+
+// CreateLeaderboard stores a new board definition, failing with ErrLeaderboardExists
+// when the id is already taken.
+func (h *Handler) CreateLeaderboard(board *models.Leaderboard) error {
+	if err := prepareLeaderboard(board); err != nil {
+		return err
+	}
+	createdAt := unixNow()
+	created, err := createBoardScript.Run(h.client, []string{"board:" + board.ID, "leaderboards"},
+		board.ID,
+		"title", board.Title,
+		"sort_order", board.SortOrder,
+		"scoring_rule", board.ScoringRule,
+		"win_points", board.WinPoints,
+		"draw_points", board.DrawPoints,
+		"loss_points", board.LossPoints,
+		"created_at", createdAt,
+	).Int()
+	if err != nil {
+		return err
+	}
+	if created == 0 {
+		return ErrLeaderboardExists
+	}
+	board.CreatedAt = formatUnix(createdAt)
+	return nil
+}
+
+// SaveLeaderboard stores a board definition. Scores already on the board are kept
+// when the rule changes.
+func (h *Handler) SaveLeaderboard(board *models.Leaderboard) error {
+	if err := prepareLeaderboard(board); err != nil {
+		return err
+	}
+	createdAt := h.client.HGet("board:"+board.ID, "created_at").Val()
+	if createdAt == "" {
+		createdAt = unixNow()
+	}
+	_, err := h.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet("board:"+board.ID, map[string]interface{}{
+			"id":           board.ID,
+			"title":        board.Title,
+			"sort_order":   board.SortOrder,
+			"scoring_rule": board.ScoringRule,
+			"win_points":   board.WinPoints,
+			"draw_points":  board.DrawPoints,
+			"loss_points":  board.LossPoints,
+			"created_at":   createdAt,
+		})
+		pipe.SAdd("leaderboards", board.ID)
+		return nil
+	})
+	board.CreatedAt = formatUnix(createdAt)
+	return err
+}
+
+// DeleteLeaderboard drops a board together with its scores. The default board can't be
+// removed. The definition goes first so score writes still in flight stop touching the board.
+func (h *Handler) DeleteLeaderboard(id string) error {
+	if id == DefaultLeaderboard {
+		return errors.New("The default leaderboard can't be deleted")
+	}
+	board, err := h.FetchLeaderboard(id)
+	if err != nil {
+		return err
+	}
+	_, err = h.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del("board:"+id, boardKey(board))
+		pipe.SRem("leaderboards", id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	buckets, err := h.matchingKeys(boardKey(board) + ":*")
+	if err != nil {
+		return err
+	}
+	if len(buckets) > 0 {
+		return h.client.Del(buckets...).Err()
+	}
+	return nil
+}
+
+// matchingKeys returns every key matching pattern, scanning in batches.
+func (h *Handler) matchingKeys(pattern string) ([]string, error) {
+	var matched []string
+	var cursor uint64
+	for {
+		keys, next, err := h.client.Scan(cursor, pattern, 100).Result()
+		if err != nil {
+			return matched, err
+		}
+		matched = append(matched, keys...)
+		if next == 0 {
+			return matched, nil
+		}
+		cursor = next
+	}
+}
+
+// matchScore is what a player with ownScore earns on the board from one match.
+func matchScore(board *models.Leaderboard, ownScore, opponentScore int) int {
+	switch board.ScoringRule {
+	case ScoringWins:
+		if ownScore > opponentScore {
+			return 1
+		}
+		return 0
+	case ScoringScore, ScoringBest:
+		return ownScore
+	}
+	if ownScore > opponentScore {
+		return board.WinPoints
+	} else if ownScore == opponentScore {
+		return board.DrawPoints
+	}
+	return board.LossPoints
+}
+
+// addScore applies one player's match result to the board and its current day, week
+// and month buckets under the board's scoring rule.
+func (h *Handler) addScore(board *models.Leaderboard, userID string, ownScore, opponentScore int) error {
+	points := matchScore(board, ownScore, opponentScore)
+	if err := h.addBoardScore(board, userID, points, time.Time{}); err != nil {
+		return err
+	}
+	buckets, expiries := h.periodBoards(board)
+	for i, bucket := range buckets {
+		if err := h.addBoardScore(bucket, userID, points, expiries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addBoardScore writes the score and, for period buckets, the expiry in one step so a
+// bucket is never left without a TTL.
+func (h *Handler) addBoardScore(board *models.Leaderboard, userID string, points int, expireAt time.Time) error {
+	var expireUnix int64
+	if !expireAt.IsZero() {
+		expireUnix = expireAt.Unix()
+	}
+	keys := []string{boardKey(board)}
+	if board.ID != DefaultLeaderboard {
+		keys = append(keys, "board:"+board.ID)
+	}
+	written, err := addScoreScript.Run(h.client, keys, userID, points, board.ScoringRule, board.SortOrder, expireUnix).Int()
+	if err != nil {
+		return err
+	}
+	if written < 0 {
+		return ErrUnknownLeaderboard
+	}
+	return nil
+}
+
+// FetchStandings returns the user's score and rank on every board they are ranked on.
+func (h *Handler) FetchStandings(userID string) ([]models.BoardStanding, error) {
+	boards, err := h.ListLeaderboards()
+	if err != nil {
+		return nil, err
+	}
+	var standings []models.BoardStanding
+	for _, board := range boards {
+		score, rank := h.FetchStanding(board, userID)
+		if rank == 0 {
+			continue
+		}
+		standings = append(standings, models.BoardStanding{Leaderboard: board.ID, Score: score, Rank: rank})
+	}
+	return standings, nil
+}
+
+// boardRank is the 0-based position of the user on the board in its sort order.
+func (h *Handler) boardRank(board *models.Leaderboard, userID string) (int64, error) {
+	if board.SortOrder == SortAsc {
+		return h.client.ZRank(boardKey(board), userID).Result()
+	}
+	return h.client.ZRevRank(boardKey(board), userID).Result()
+}
+
+func (h *Handler) boardRange(board *models.Leaderboard, start, end int64) ([]redis.Z, error) {
+	if board.SortOrder == SortAsc {
+		return h.client.ZRangeWithScores(boardKey(board), start, end).Result()
+	}
+	return h.client.ZRevRangeWithScores(boardKey(board), start, end).Result()
+}
+
+func (h *Handler) HandleListLeaderboards(w http.ResponseWriter, r *http.Request) {
+	log.Println("ListLeaderboards - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	boards, err := h.ListLeaderboards()
+	if err != nil {
+		log.Printf("ListLeaderboards - %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: boards})
+}
+
+func (h *Handler) HandleCreateLeaderboard(w http.ResponseWriter, r *http.Request) {
+	log.Println("CreateLeaderboard - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var board models.Leaderboard
+	if err := json.NewDecoder(r.Body).Decode(&board); err != nil {
+		log.Printf("CreateLeaderboard - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	if board.ID == DefaultLeaderboard {
+		errorResponse(w, http.StatusConflict, ErrLeaderboardExists.Error())
+		return
+	}
+	if err := h.CreateLeaderboard(&board); errors.Is(err, ErrLeaderboardExists) {
+		errorResponse(w, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		writeUserError(w, err, http.StatusInternalServerError)
+		return
+	}
+	log.Printf("CreateLeaderboard - %s created", board.ID)
+	successResponse(w, models.SuccessResponse{Status: true, Result: board})
+}
+
+func (h *Handler) HandleUpdateLeaderboard(w http.ResponseWriter, r *http.Request) {
+	log.Println("UpdateLeaderboard - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	board, err := h.FetchLeaderboard(mux.Vars(r)["board"])
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	var update models.LeaderboardUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		log.Printf("UpdateLeaderboard - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	if update.Title != nil {
+		board.Title = *update.Title
+	}
+	if update.SortOrder != nil {
+		board.SortOrder = *update.SortOrder
+	}
+	if update.ScoringRule != nil {
+		board.ScoringRule = *update.ScoringRule
+	}
+	if update.WinPoints != nil {
+		board.WinPoints = *update.WinPoints
+	}
+	if update.DrawPoints != nil {
+		board.DrawPoints = *update.DrawPoints
+	}
+	if update.LossPoints != nil {
+		board.LossPoints = *update.LossPoints
+	}
+	if err := h.SaveLeaderboard(board); err != nil {
+		writeUserError(w, err, http.StatusInternalServerError)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: board})
+}
+
+func (h *Handler) HandleDeleteLeaderboard(w http.ResponseWriter, r *http.Request) {
+	log.Println("DeleteLeaderboard - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	id := mux.Vars(r)["board"]
+	if err := h.DeleteLeaderboard(id); errors.Is(err, ErrUnknownLeaderboard) {
+		errorResponse(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("DeleteLeaderboard - %s deleted", id)
+	successResponse(w, models.SuccessResponse{Status: true, Result: map[string]interface{}{"message": "Leaderboard deleted"}})
+}
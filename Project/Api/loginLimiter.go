@@ -0,0 +1,81 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("Invalid username or password")
+	ErrLoginLocked        = errors.New("Too many failed login attempts, try again later")
+)
+
+const maxLoginLockout = 24 * time.Hour
+
+// loginSubjects are the counters a login attempt is charged against.
+func loginSubjects(username, ip string) []string {
+	subjects := []string{"user:" + normalizeUsername(username)}
+	if ip != "" {
+		subjects = append(subjects, "ip:"+ip)
+	}
+	return subjects
+}
+
+func (h *Handler) loginLimit(subject string) int64 {
+	if strings.HasPrefix(subject, "ip:") {
+		return int64(h.config.LoginMaxAttemptsPerIP)
+	}
+	return int64(h.config.LoginMaxAttempts)
+}
+
+// checkLoginAllowed fails while the username or the client IP is locked out.
+func (h *Handler) checkLoginAllowed(username, ip string) error {
+	for _, subject := range loginSubjects(username, ip) {
+		if h.client.Exists("login_lock:"+subject).Val() > 0 {
+			return ErrLoginLocked
+		}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed attempt. Reaching the limit locks the subject, and every
+// lockout inside a day doubles the next one up to maxLoginLockout.
+func (h *Handler) recordLoginFailure(username, ip string) {
+	for _, subject := range loginSubjects(username, ip) {
+		limit := h.loginLimit(subject)
+		if limit <= 0 {
+			continue
+		}
+		failures := h.client.Incr("login_fail:" + subject).Val()
+		if failures == 1 {
+			h.client.Expire("login_fail:"+subject, h.config.LoginFailureWindow)
+		}
+		if failures < limit {
+			continue
+		}
+		lockouts := h.client.Incr("login_lockouts:" + subject).Val()
+		h.client.Expire("login_lockouts:"+subject, maxLoginLockout)
+		lockout := h.config.LoginLockout
+		for i := int64(1); i < lockouts && lockout < maxLoginLockout; i++ {
+			lockout *= 2
+		}
+		if lockout > maxLoginLockout {
+			lockout = maxLoginLockout
+		}
+		h.client.Set("login_lock:"+subject, lockouts, lockout)
+		h.client.Del("login_fail:" + subject)
+	}
+}
+
+// clearLoginFailures resets the username counters after a successful login.
+func (h *Handler) clearLoginFailures(username string) {
+	subject := "user:" + normalizeUsername(username)
+	h.client.Del("login_fail:"+subject, "login_lockouts:"+subject)
+}
+
+// UnlockLogin lifts a lockout on the username and forgets its failure history.
+func (h *Handler) UnlockLogin(username string) error {
+	subject := "user:" + normalizeUsername(username)
+	return h.client.Del("login_fail:"+subject, "login_lockouts:"+subject, "login_lock:"+subject).Err()
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
@@ -12,7 +13,7 @@ func (h *Handler) HandleLeaderboard(w http.ResponseWriter, r *http.Request) {
 	log.Println("Leaderboard - Called")
 	w.Header().Set(ContentType, ApplicationJSON)
 
-	var leaderbordInfo models.ListInfo
+	var leaderbordInfo models.LeaderboardInfo
 	if err := json.NewDecoder(r.Body).Decode(&leaderbordInfo); err != nil {
 		log.Printf("Fetchleaderboard - Invalid JSON format")
 		errorResponse(w, http.StatusNotFound, InvalidJSONInputMsg)
@@ -24,7 +25,21 @@ func (h *Handler) HandleLeaderboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	leaderboard, err := h.BuildLeaderboardList(leaderbordInfo)
+	board, err := h.FetchLeaderboard(leaderbordInfo.Leaderboard)
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if leaderbordInfo.Season != "" {
+		board, err = h.archivedBoard(board, leaderbordInfo.Season)
+	} else {
+		board, err = periodBoard(board, leaderbordInfo.Period, leaderbordInfo.Previous)
+	}
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	leaderboard, err := h.BuildLeaderboardList(board, models.ListInfo{Count: leaderbordInfo.Count, Page: leaderbordInfo.Page})
 	if err != nil {
 		log.Println("Error building leaderboard list:", err)
 		errorResponse(w, http.StatusNotFound, "Could not build leaderboard list")
@@ -34,7 +49,7 @@ func (h *Handler) HandleLeaderboard(w http.ResponseWriter, r *http.Request) {
 		Status: true,
 		Result: leaderboard,
 	}
-	log.Println("Leaderboard page %d fetch successfuly.", leaderbordInfo.Count)
+	log.Printf("Leaderboard page %d fetch successfuly.", leaderbordInfo.Count)
 	successResponse(w, result)
 }
 
@@ -49,7 +64,10 @@ func (h *Handler) HandleMatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.UpdateScore(match); err != nil {
+	if err := h.UpdateScore(match); errors.Is(err, ErrUnknownLeaderboard) {
+		errorResponse(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
 		log.Printf("GetMatchInfo - update score failed : %s", err)
 		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
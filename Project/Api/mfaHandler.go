@@ -0,0 +1,276 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dzdrgl/redis-Api/models"
+	"github.com/go-redis/redis"
+)
+
+const (
+	recoveryCodeCount   = 10
+	mfaChallengeTTL     = 5 * time.Minute
+	mfaChallengeTries   = 5
+	mfaPendingSecretTTL = 15 * time.Minute
+)
+
+var (
+	ErrInvalidMFACode      = errors.New("Invalid two-factor code")
+	ErrInvalidMFAChallenge = errors.New("Invalid or expired login challenge")
+)
+
+// totpStepScript records the TOTP time step as used unless it, or a later one, already was.
+// KEYS: user. ARGV: step.
+var totpStepScript = redis.NewScript(`
+local last = tonumber(redis.call('HGET', KEYS[1], 'totp_last_step') or '-1')
+if tonumber(ARGV[1]) <= last then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'totp_last_step', ARGV[1])
+return 1
+`)
+
+func (h *Handler) HandleEnrollMFA(w http.ResponseWriter, r *http.Request) {
+	log.Println("EnrollMFA - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	enrollment, err := h.EnrollMFA(currentUser.ID)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: enrollment})
+}
+
+func (h *Handler) HandleVerifyMFA(w http.ResponseWriter, r *http.Request) {
+	log.Println("VerifyMFA - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var codeInfo models.MFACode
+	if err := json.NewDecoder(r.Body).Decode(&codeInfo); err != nil {
+		log.Printf("VerifyMFA - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	codes, err := h.ActivateMFA(currentUser.ID, codeInfo.Code)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: map[string]interface{}{"recoverycodes": codes}})
+}
+
+func (h *Handler) HandleDisableMFA(w http.ResponseWriter, r *http.Request) {
+	log.Println("DisableMFA - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var codeInfo models.MFACode
+	if err := json.NewDecoder(r.Body).Decode(&codeInfo); err != nil {
+		log.Printf("DisableMFA - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	if err := h.DisableMFA(currentUser.ID, codeInfo.Code); err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: "Two-factor authentication disabled"})
+}
+
+func (h *Handler) HandleMFALogin(w http.ResponseWriter, r *http.Request) {
+	log.Println("MFALogin - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var loginInfo models.MFALoginInfo
+	if err := json.NewDecoder(r.Body).Decode(&loginInfo); err != nil {
+		log.Printf("MFALogin - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	tokens, err := h.CompleteMFALogin(loginInfo.Challenge, loginInfo.Code)
+	if errors.Is(err, ErrAccountPendingDeletion) || errors.Is(err, ErrAccountSuspended) || errors.Is(err, ErrAccountBanned) {
+		errorResponse(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if errors.Is(err, ErrLoginLocked) {
+		errorResponse(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if err != nil {
+		errorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: tokens})
+}
+
+func (h *Handler) mfaEnabled(userID string) bool {
+	return h.FetchUserFieldWithID(userID, "totp_enabled") == "1"
+}
+
+// EnrollMFA creates a new secret that only becomes active once a code from it is verified.
+func (h *Handler) EnrollMFA(userID string) (*models.MFAEnrollment, error) {
+	if h.mfaEnabled(userID) {
+		return nil, errors.New("Two-factor authentication is already enabled")
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := h.client.Set("totp_pending:"+userID, secret, mfaPendingSecretTTL).Err(); err != nil {
+		return nil, err
+	}
+	username := h.FetchUserFieldWithID(userID, "username")
+	return &models.MFAEnrollment{
+		Secret: secret,
+		URI:    totpURI(h.config.TOTPIssuer, username, secret),
+	}, nil
+}
+
+// ActivateMFA turns two-factor on when the code matches the pending secret and
+// returns a fresh set of recovery codes.
+func (h *Handler) ActivateMFA(userID, code string) ([]string, error) {
+	secret := h.client.Get("totp_pending:" + userID).Val()
+	if secret == "" {
+		return nil, errors.New("No pending enrolment, start again")
+	}
+	step := matchTOTP(secret, code, time.Now())
+	if step < 0 {
+		return nil, ErrInvalidMFACode
+	}
+	err := h.client.HMSet("user:"+userID, map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_enabled":   "1",
+		"totp_last_step": step,
+	}).Err()
+	if err != nil {
+		return nil, err
+	}
+	h.client.Del("totp_pending:" + userID)
+	return h.newRecoveryCodes(userID)
+}
+
+func (h *Handler) DisableMFA(userID, code string) error {
+	if !h.mfaEnabled(userID) {
+		return errors.New("Two-factor authentication is not enabled")
+	}
+	if !h.checkMFACode(userID, code) {
+		return ErrInvalidMFACode
+	}
+	h.client.Del("recovery:" + userID)
+	return h.client.HDel("user:"+userID, "totp_secret", "totp_enabled", "totp_last_step").Err()
+}
+
+// startMFAChallenge parks a password-verified login until the second factor is checked.
+// The username and IP are kept so wrong codes count against the login limiter.
+func (h *Handler) startMFAChallenge(userID, username string, session models.Session) (*models.AuthTokens, error) {
+	challenge, err := h.randomToken()
+	if err != nil {
+		return nil, err
+	}
+	key := "mfa:" + hashToken(challenge)
+	err = h.client.HMSet(key, map[string]interface{}{
+		"user_id":    userID,
+		"username":   username,
+		"device":     session.Device,
+		"ip":         session.IP,
+		"user_agent": session.UserAgent,
+	}).Err()
+	if err != nil {
+		return nil, err
+	}
+	h.client.Expire(key, mfaChallengeTTL)
+	return &models.AuthTokens{MFARequired: true, MFAChallenge: challenge}, nil
+}
+
+// CompleteMFALogin finishes a login started by UserLogin. A challenge is dropped
+// after too many wrong codes, and every wrong code is also a login failure so new
+// challenges can't be used to keep guessing. The account status is checked again since
+// the user may have been sanctioned or scheduled for deletion since the password step.
+func (h *Handler) CompleteMFALogin(challenge, code string) (*models.AuthTokens, error) {
+	key := "mfa:" + hashToken(challenge)
+	fields := h.client.HGetAll(key).Val()
+	userID := fields["user_id"]
+	if userID == "" {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if err := h.checkLoginAllowed(fields["username"], fields["ip"]); err != nil {
+		return nil, err
+	}
+	if !h.checkMFACode(userID, code) {
+		h.recordLoginFailure(fields["username"], fields["ip"])
+		if h.client.HIncrBy(key, "attempts", 1).Val() >= mfaChallengeTries {
+			h.client.Del(key)
+		}
+		return nil, ErrInvalidMFACode
+	}
+	if deleted := h.client.Del(key).Val(); deleted == 0 {
+		return nil, ErrInvalidMFAChallenge
+	}
+	h.clearLoginFailures(fields["username"])
+	if err := h.checkLoginStatus(userID); err != nil {
+		return nil, err
+	}
+	session := models.Session{
+		Device:    fields["device"],
+		IP:        fields["ip"],
+		UserAgent: fields["user_agent"],
+	}
+	token, err := h.CreateToken(userID, session)
+	if err != nil {
+		return nil, err
+	}
+	return h.issueTokens(userID, token)
+}
+
+// checkMFACode accepts a current TOTP code or an unused recovery code. A TOTP code
+// cannot be replayed once its time step has been used.
+func (h *Handler) checkMFACode(userID, code string) bool {
+	code = strings.TrimSpace(code)
+	secret := h.FetchUserFieldWithID(userID, "totp_secret")
+	if secret != "" {
+		if step := matchTOTP(secret, code, time.Now()); step >= 0 {
+			return totpStepScript.Run(h.client, []string{"user:" + userID}, step).Val() == int64(1)
+		}
+	}
+	normalized := strings.ToLower(strings.Replace(code, "-", "", -1))
+	return h.client.SRem("recovery:"+userID, hashToken(normalized)).Val() == 1
+}
+
+func (h *Handler) newRecoveryCodes(userID string) ([]string, error) {
+	h.client.Del("recovery:" + userID)
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := hex.EncodeToString(buf)
+		if err := h.client.SAdd("recovery:"+userID, hashToken(raw)).Err(); err != nil {
+			return nil, err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+	}
+	return codes, nil
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Dzdrgl/redis-Api/models"
+)
+
+// Notifier delivers messages to users outside the API, e.g. password reset codes.
+type Notifier interface {
+	SendPasswordReset(user *models.User, code string) error
+}
+
+// LogNotifier writes notifications to the server log. Meant for local development.
+type LogNotifier struct{}
+
+func (LogNotifier) SendPasswordReset(user *models.User, code string) error {
+	log.Printf("Notifier - password reset code for %s (id %s): %s", user.Username, user.ID, code)
+	return nil
+}
+
+// FileNotifier appends notifications to a file.
+type FileNotifier struct {
+	Path string
+}
+
+func (n FileNotifier) SendPasswordReset(user *models.User, code string) error {
+	file, err := os.OpenFile(n.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "%s password reset for %s (id %s): %s\n", time.Now().Format(time.RFC3339), user.Username, user.ID, code)
+	return err
+}
+
+func newNotifier(config Config) Notifier {
+	if config.NotifierFile != "" {
+		return FileNotifier{Path: config.NotifierFile}
+	}
+	return LogNotifier{}
+}
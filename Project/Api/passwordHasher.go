@@ -0,0 +1,153 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher is one password hashing scheme. Stored hashes carry their own
+// parameters, so a hasher can tell when a hash was made with different settings.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(hash, password string) (bool, error)
+	// Owns reports whether the hash was produced by this scheme.
+	Owns(hash string) bool
+	// NeedsRehash reports whether a hash this scheme owns uses outdated parameters.
+	NeedsRehash(hash string) bool
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (b BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	return string(hashed), err
+}
+
+func (b BcryptHasher) Verify(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b BcryptHasher) Owns(hash string) bool {
+	return strings.HasPrefix(hash, "$2")
+}
+
+func (b BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != b.Cost
+}
+
+// Argon2idHasher stores hashes in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyLen  uint32
+}
+
+func (a Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a Argon2idHasher) Verify(hash, password string) (bool, error) {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (a Argon2idHasher) Owns(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (a Argon2idHasher) NeedsRehash(hash string) bool {
+	params, _, key, err := parseArgon2id(hash)
+	return err != nil || params.Time != a.Time || params.Memory != a.Memory ||
+		params.Threads != a.Threads || uint32(len(key)) != a.KeyLen
+}
+
+func parseArgon2id(hash string) (Argon2idHasher, []byte, []byte, error) {
+	var params Argon2idHasher
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("Invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("Unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	return params, salt, key, nil
+}
+
+// newPasswordHasher returns the hasher used for new hashes. Every known scheme is
+// kept for verification so users can still log in after the algorithm changes.
+func newPasswordHasher(config Config) (PasswordHasher, []PasswordHasher) {
+	bcryptHasher := BcryptHasher{Cost: config.BcryptCost}
+	argonHasher := Argon2idHasher{
+		Time:    config.Argon2Time,
+		Memory:  config.Argon2Memory,
+		Threads: config.Argon2Threads,
+		KeyLen:  32,
+	}
+	known := []PasswordHasher{bcryptHasher, argonHasher}
+	if config.PasswordHasher == "argon2id" {
+		return argonHasher, known
+	}
+	return bcryptHasher, known
+}
+
+func (h *Handler) hashPassword(password string) (string, error) {
+	hashed, err := h.hasher.Hash(password)
+	if err != nil {
+		return "", fmt.Errorf("Error hashing the password: %v", err)
+	}
+	return hashed, nil
+}
+
+// verifyPassword checks the password with whichever scheme made the hash.
+func (h *Handler) verifyPassword(hash, password string) bool {
+	for _, hasher := range h.knownHashers {
+		if hasher.Owns(hash) {
+			ok, _ := hasher.Verify(hash, password)
+			return ok
+		}
+	}
+	return false
+}
+
+// needsRehash is true when the hash was made by another scheme or with outdated parameters.
+func (h *Handler) needsRehash(hash string) bool {
+	return !h.hasher.Owns(hash) || h.hasher.NeedsRehash(hash)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+//go:embed commonPasswords.txt
+var commonPasswordList string
+
+var commonPasswords = loadCommonPasswords(commonPasswordList)
+
+// PasswordPolicyError lists every rule a password broke so the client can show them all at once.
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "Password does not meet the policy: " + strings.Join(e.Violations, "; ")
+}
+
+var passwordClasses = map[string]struct {
+	check   func(rune) bool
+	message string
+}{
+	"lower":  {unicode.IsLower, "Password must contain a lowercase letter"},
+	"upper":  {unicode.IsUpper, "Password must contain an uppercase letter"},
+	"digit":  {unicode.IsDigit, "Password must contain a digit"},
+	"symbol": {isSymbol, "Password must contain a symbol"},
+}
+
+// CheckPasswordPolicy validates a new password for the given username and
+// returns a *PasswordPolicyError listing the rules it breaks.
+func (h *Handler) CheckPasswordPolicy(password, username string) error {
+	var violations []string
+	if len([]rune(password)) < h.config.PasswordMinLength {
+		violations = append(violations, fmt.Sprintf("Password must be at least %d characters", h.config.PasswordMinLength))
+	}
+	for _, class := range h.config.PasswordClasses {
+		rule, ok := passwordClasses[class]
+		if ok && strings.IndexFunc(password, rule.check) < 0 {
+			violations = append(violations, rule.message)
+		}
+	}
+	lower := strings.ToLower(password)
+	if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+		violations = append(violations, "Password must not contain the username")
+	}
+	if commonPasswords[lower] {
+		violations = append(violations, "Password is too common or has appeared in a data breach")
+	}
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func isSymbol(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+func loadCommonPasswords(list string) map[string]bool {
+	passwords := map[string]bool{}
+	for _, line := range strings.Split(list, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			passwords[strings.ToLower(line)] = true
+		}
+	}
+	return passwords
+}
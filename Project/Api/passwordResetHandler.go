@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Dzdrgl/redis-Api/models"
+)
+
+var ErrInvalidResetCode = errors.New("Invalid or expired reset code")
+
+func (h *Handler) HandleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	log.Println("RequestPasswordReset - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var resetInfo models.PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&resetInfo); err != nil {
+		log.Printf("RequestPasswordReset - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	if resetInfo.Username == "" {
+		errorResponse(w, http.StatusBadRequest, "Username must not be empty")
+		return
+	}
+	if err := h.RequestPasswordReset(resetInfo.Username); err != nil {
+		log.Printf("RequestPasswordReset - %v", err)
+	}
+	// The answer is the same whether or not the user exists.
+	successResponse(w, models.SuccessResponse{Status: true, Result: "If the account exists, a reset code has been sent"})
+}
+
+func (h *Handler) HandleConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	log.Println("ConfirmPasswordReset - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var confirmInfo models.PasswordResetConfirm
+	if err := json.NewDecoder(r.Body).Decode(&confirmInfo); err != nil {
+		log.Printf("ConfirmPasswordReset - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	if confirmInfo.Code == "" || confirmInfo.Password == "" {
+		errorResponse(w, http.StatusBadRequest, "Code and password must not be empty")
+		return
+	}
+	if err := h.ConfirmPasswordReset(confirmInfo.Code, confirmInfo.Password); err != nil {
+		var policyErr *PasswordPolicyError
+		if errors.Is(err, ErrInvalidResetCode) || errors.As(err, &policyErr) {
+			writeUserError(w, err, http.StatusBadRequest)
+			return
+		}
+		log.Printf("ConfirmPasswordReset - %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: "Password has been reset"})
+}
+
+// RequestPasswordReset creates a single-use reset code and hands it to the notifier.
+// A new request replaces any code the user still has outstanding.
+func (h *Handler) RequestPasswordReset(username string) error {
+	userID := h.GetUserIDWithUsername(username)
+	if userID == "" {
+		return errors.New("User not found")
+	}
+	code, err := h.randomToken()
+	if err != nil {
+		return err
+	}
+	if previous := h.client.Get("reset_user:" + userID).Val(); previous != "" {
+		h.client.Del("reset:" + previous)
+	}
+	codeHash := hashToken(code)
+	if err := h.client.Set("reset:"+codeHash, userID, h.config.PasswordResetTTL).Err(); err != nil {
+		return err
+	}
+	if err := h.client.Set("reset_user:"+userID, codeHash, h.config.PasswordResetTTL).Err(); err != nil {
+		return err
+	}
+	return h.notifier.SendPasswordReset(h.FetchUserInfoWithID(userID), code)
+}
+
+// ConfirmPasswordReset consumes the code, stores the new password and logs the user out everywhere.
+func (h *Handler) ConfirmPasswordReset(code, password string) error {
+	codeHash := hashToken(code)
+	userID := h.client.Get("reset:" + codeHash).Val()
+	if userID == "" {
+		return ErrInvalidResetCode
+	}
+	// Check the policy before spending the code so a weak password can be retried.
+	if err := h.CheckPasswordPolicy(password, h.FetchUserFieldWithID(userID, "username")); err != nil {
+		return err
+	}
+	// Only the caller that actually deletes the key may use it.
+	deleted, err := h.client.Del("reset:" + codeHash).Result()
+	if err != nil {
+		return err
+	} else if deleted == 0 {
+		return ErrInvalidResetCode
+	}
+	h.client.Del("reset_user:" + userID)
+
+	if _, err := h.UpdateUser(&models.User{Password: password}, userID); err != nil {
+		return err
+	}
+	h.UnlockLogin(h.FetchUserFieldWithID(userID, "username"))
+	return h.RevokeUserTokens(userID)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Dzdrgl/redis-Api/models"
+)
+
+const (
+	maxNameLength   = 50
+	maxBioLength    = 500
+	maxAvatarLength = 512
+	birthDateLayout = "2006-01-02"
+)
+
+// Privacy levels decide which profile fields other players see.
+const (
+	PrivacyPublic  = "public"
+	PrivacyFriends = "friends"
+	PrivacyPrivate = "private"
+)
+
+// ValidationError lists every field rule a request broke.
+type ValidationError struct {
+	Message    string
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message + ": " + strings.Join(e.Violations, "; ")
+}
+
+var languagePattern = regexp.MustCompile(`^[a-z]{2}(-[A-Z]{2})?$`)
+
+// ISO 3166-1 alpha-2 country codes.
+var countryCodes = strings.Fields(`
+AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS
+BT BV BW BY BZ CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ DE DJ DK DM DO DZ EC EE
+EG EH ER ES ET FI FJ FK FM FO FR GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY HK HM
+HN HR HT HU ID IE IL IM IN IO IQ IR IS IT JE JM JO JP KE KG KH KI KM KN KP KR KW KY KZ LA LB LC
+LI LK LR LS LT LU LV LY MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ NA
+NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF PG PH PK PL PM PN PR PS PT PW PY QA RE RO RS RU RW
+SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ TC TD TF TG TH TJ TK TL TM TN TO
+TR TT TV TW TZ UA UG UM US UY UZ VA VC VE VG VI VN VU WF WS YE YT ZA ZM ZW`)
+
+func validCountry(code string) bool {
+	return containsString(countryCodes, code)
+}
+
+// ValidateProfile checks the profile fields that are set. Empty fields mean "unchanged".
+func ValidateProfile(user *models.User) error {
+	var violations []string
+	if utf8.RuneCountInString(user.Name) > maxNameLength {
+		violations = append(violations, "Name must be at most 50 characters")
+	}
+	if utf8.RuneCountInString(user.Surname) > maxNameLength {
+		violations = append(violations, "Surname must be at most 50 characters")
+	}
+	if user.AvatarURL != "" {
+		parsed, err := url.Parse(user.AvatarURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || len(user.AvatarURL) > maxAvatarLength {
+			violations = append(violations, "Avatar URL must be an http or https URL of at most 512 characters")
+		}
+	}
+	if utf8.RuneCountInString(user.Bio) > maxBioLength {
+		violations = append(violations, "Bio must be at most 500 characters")
+	}
+	if user.Country != "" && !validCountry(user.Country) {
+		violations = append(violations, "Country must be an ISO 3166-1 alpha-2 code such as TR or US")
+	}
+	if user.Language != "" {
+		if !languagePattern.MatchString(user.Language) ||
+			(len(user.Language) == 5 && !validCountry(user.Language[3:])) {
+			violations = append(violations, "Language must be a code such as en or en-US")
+		}
+	}
+	if user.BirthDate != "" {
+		birthDate, err := time.Parse(birthDateLayout, user.BirthDate)
+		if err != nil || birthDate.After(time.Now()) || birthDate.Year() < 1900 {
+			violations = append(violations, "Birth date must be a past date in YYYY-MM-DD format")
+		}
+	}
+	if user.Privacy != "" && user.Privacy != PrivacyPublic && user.Privacy != PrivacyFriends && user.Privacy != PrivacyPrivate {
+		violations = append(violations, "Privacy must be public, friends or private")
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Message: "Invalid profile", Violations: violations}
+	}
+	return nil
+}
+
+// profileFields maps the editable profile fields to their user: hash names.
+func profileFields(user *models.User) map[string]string {
+	return map[string]string{
+		"name":       user.Name,
+		"surname":    user.Surname,
+		"avatar_url": user.AvatarURL,
+		"bio":        user.Bio,
+		"country":    user.Country,
+		"language":   user.Language,
+		"birth_date": user.BirthDate,
+		"privacy":    user.Privacy,
+	}
+}
+
+// VisibleProfile trims a profile down to what the viewer may see under the owner's privacy setting.
+func (h *Handler) VisibleProfile(user *models.User, viewerID string) *models.User {
+	if user.ID == viewerID {
+		return user
+	}
+	privacy := user.Privacy
+	if privacy == PrivacyFriends && h.client.ZScore("friends:"+user.ID, viewerID).Err() == nil {
+		privacy = PrivacyPublic
+	}
+	if privacy == PrivacyPublic {
+		visible := *user
+		visible.BirthDate = ""
+		visible.UpdatedAt = ""
+		return &visible
+	}
+	return &models.User{
+		ID:        user.ID,
+		Username:  user.Username,
+		AvatarURL: user.AvatarURL,
+		Role:      user.Role,
+		Privacy:   user.Privacy,
+	}
+}
+
+func privacyOrDefault(privacy string) string {
+	if privacy == "" {
+		return PrivacyPublic
+	}
+	return privacy
+}
+
+func unixNow() string {
+	return strconv.FormatInt(time.Now().Unix(), 10)
+}
@@ -0,0 +1,327 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Dzdrgl/redis-Api/models"
+	"github.com/go-redis/redis"
+	"github.com/gorilla/mux"
+)
+
+// Report states. New reports are open, a moderator claiming one moves it to
+// reviewing, and resolving it ends in actioned or dismissed.
+const (
+	ReportOpen      = "open"
+	ReportReviewing = "reviewing"
+	ReportActioned  = "actioned"
+	ReportDismissed = "dismissed"
+)
+
+var reportCategories = []string{"cheating", "abusive_name", "harassment", "other"}
+
+const (
+	maxReportReason   = 1000
+	maxReportMatchRef = 100
+)
+
+var ErrReportLimit = errors.New("Too many reports, try again later")
+
+func reportQueueKey(status string) string {
+	return "reports:" + status
+}
+
+func (h *Handler) HandleCreateReport(w http.ResponseWriter, r *http.Request) {
+	log.Println("CreateReport - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var request models.ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("CreateReport - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	report, err := h.CreateReport(currentUser.ID, request)
+	if errors.Is(err, ErrReportLimit) {
+		errorResponse(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if err != nil {
+		writeUserError(w, err, http.StatusBadRequest)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: report})
+}
+
+// CreateReport files a report against another player and puts it in the open queue.
+func (h *Handler) CreateReport(reporterID string, request models.ReportRequest) (*models.Report, error) {
+	var violations []string
+	if request.TargetID == reporterID {
+		violations = append(violations, "You can't report yourself")
+	} else if h.FetchUserFieldWithID(request.TargetID, "username") == "" {
+		violations = append(violations, "Reported user does not exist")
+	}
+	if !containsString(reportCategories, request.Category) {
+		violations = append(violations, "Category must be cheating, abusive_name, harassment or other")
+	}
+	if request.Reason == "" || utf8.RuneCountInString(request.Reason) > maxReportReason {
+		violations = append(violations, "Reason must be between 1 and 1000 characters")
+	}
+	if len(request.MatchRef) > maxReportMatchRef {
+		violations = append(violations, "Match reference must be at most 100 characters")
+	}
+	if len(violations) > 0 {
+		return nil, &ValidationError{Message: "Invalid report", Violations: violations}
+	}
+	if err := h.takeReportSlot(reporterID); err != nil {
+		return nil, err
+	}
+
+	id := strconv.FormatInt(h.client.Incr("report_id").Val(), 10)
+	now := time.Now().Unix()
+	fields := map[string]interface{}{
+		"id":         id,
+		"reporter":   reporterID,
+		"target":     request.TargetID,
+		"category":   request.Category,
+		"reason":     request.Reason,
+		"match_ref":  request.MatchRef,
+		"status":     ReportOpen,
+		"created_at": now,
+		"updated_at": now,
+	}
+	_, err := h.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet("report:"+id, fields)
+		pipe.ZAdd(reportQueueKey(ReportOpen), redis.Z{Score: float64(now), Member: id})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h.FetchReport(id), nil
+}
+
+// takeReportSlot counts the report against the reporter's allowance for the current window.
+// The counter is created with its expiry and incremented in one transaction so it can't
+// outlive the window.
+func (h *Handler) takeReportSlot(reporterID string) error {
+	if h.config.ReportLimit <= 0 {
+		return nil
+	}
+	key := "report_limit:" + reporterID
+	var incr *redis.IntCmd
+	_, err := h.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SetNX(key, 0, h.config.ReportWindow)
+		incr = pipe.Incr(key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if incr.Val() > int64(h.config.ReportLimit) {
+		return ErrReportLimit
+	}
+	return nil
+}
+
+func (h *Handler) FetchReport(id string) *models.Report {
+	fields := h.client.HGetAll("report:" + id).Val()
+	if fields["id"] == "" {
+		return nil
+	}
+	return &models.Report{
+		ID:         fields["id"],
+		ReporterID: fields["reporter"],
+		TargetID:   fields["target"],
+		Category:   fields["category"],
+		Reason:     fields["reason"],
+		MatchRef:   fields["match_ref"],
+		Status:     fields["status"],
+		Moderator:  fields["moderator"],
+		Resolution: fields["resolution"],
+		CreatedAt:  formatUnix(fields["created_at"]),
+		UpdatedAt:  formatUnix(fields["updated_at"]),
+	}
+}
+
+// FetchReportsBy returns every report the user filed, whatever queue it is in.
+func (h *Handler) FetchReportsBy(reporterID string) ([]*models.Report, error) {
+	var reports []*models.Report
+	for _, status := range []string{ReportOpen, ReportReviewing, ReportActioned, ReportDismissed} {
+		ids, err := h.client.ZRange(reportQueueKey(status), 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if report := h.FetchReport(id); report != nil && report.ReporterID == reporterID {
+				reports = append(reports, report)
+			}
+		}
+	}
+	return reports, nil
+}
+
+func (h *Handler) HandleReportQueue(w http.ResponseWriter, r *http.Request) {
+	log.Println("ReportQueue - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	query := r.URL.Query()
+	status := query.Get("status")
+	if status == "" {
+		status = ReportOpen
+	}
+	if status != ReportOpen && status != ReportReviewing && status != ReportActioned && status != ReportDismissed {
+		errorResponse(w, http.StatusBadRequest, "Status must be open, reviewing, actioned or dismissed")
+		return
+	}
+	listInfo := models.ListInfo{Count: 20, Page: 1}
+	if count, err := strconv.ParseInt(query.Get("count"), 10, 64); err == nil {
+		listInfo.Count = count
+	}
+	if page, err := strconv.ParseInt(query.Get("page"), 10, 64); err == nil {
+		listInfo.Page = page
+	}
+	if listInfo.Count <= 0 || listInfo.Page <= 0 {
+		errorResponse(w, http.StatusBadRequest, "Invalid page or count value")
+		return
+	}
+
+	// Open work is served oldest first, closed reports newest first.
+	start := listInfo.Count * (listInfo.Page - 1)
+	end := start + listInfo.Count - 1
+	var ids []string
+	var err error
+	if status == ReportOpen || status == ReportReviewing {
+		ids, err = h.client.ZRange(reportQueueKey(status), start, end).Result()
+	} else {
+		ids, err = h.client.ZRevRange(reportQueueKey(status), start, end).Result()
+	}
+	if err != nil {
+		log.Printf("ReportQueue - %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	var reports []*models.Report
+	for _, id := range ids {
+		if report := h.FetchReport(id); report != nil {
+			reports = append(reports, report)
+		}
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: reports})
+}
+
+func (h *Handler) HandleClaimReport(w http.ResponseWriter, r *http.Request) {
+	log.Println("ClaimReport - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	moderator, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	id := mux.Vars(r)["id"]
+	if err := h.moveReport(id, ReportOpen, ReportReviewing, moderator.ID, ""); err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: h.FetchReport(id)})
+}
+
+func (h *Handler) HandleResolveReport(w http.ResponseWriter, r *http.Request) {
+	log.Println("ResolveReport - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var resolution models.ReportResolution
+	if err := json.NewDecoder(r.Body).Decode(&resolution); err != nil {
+		log.Printf("ResolveReport - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	moderator, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	report, err := h.ResolveReport(mux.Vars(r)["id"], moderator, resolution)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("ResolveReport - report %s %s by %s", report.ID, report.Status, moderator.ID)
+	successResponse(w, models.SuccessResponse{Status: true, Result: report})
+}
+
+// ResolveReport closes a report. Actioning it may sanction the reported player in the
+// same step; the report is only closed once the sanction has been applied.
+func (h *Handler) ResolveReport(id string, moderator models.User, resolution models.ReportResolution) (*models.Report, error) {
+	report := h.FetchReport(id)
+	if report == nil {
+		return nil, errors.New("Report does not exist")
+	}
+	if report.Status != ReportOpen && report.Status != ReportReviewing {
+		return nil, errors.New("Report is already closed")
+	}
+	switch resolution.Status {
+	case ReportActioned:
+	case ReportDismissed:
+		if resolution.Sanction != nil {
+			return nil, errors.New("Dismissed reports can't carry a sanction")
+		}
+	default:
+		return nil, errors.New("Status must be actioned or dismissed")
+	}
+	// Closing the report first means only the moderator who wins the move sanctions.
+	if err := h.moveReport(id, report.Status, resolution.Status, moderator.ID, resolution.Note); err != nil {
+		return nil, err
+	}
+	if resolution.Sanction != nil {
+		if resolution.Sanction.Reason == "" {
+			resolution.Sanction.Reason = resolution.Note
+		}
+		if _, err := h.ApplySanction(report.TargetID, moderator, *resolution.Sanction); err != nil {
+			if moveErr := h.moveReport(id, resolution.Status, report.Status, moderator.ID, ""); moveErr != nil {
+				log.Printf("ResolveReport - reopening %s failed: %v", id, moveErr)
+			}
+			return nil, err
+		}
+	}
+	return h.FetchReport(id), nil
+}
+
+// moveReport switches a report between queues, failing if another moderator moved it first.
+func (h *Handler) moveReport(id, from, to, moderatorID, note string) error {
+	key := "report:" + id
+	return h.client.Watch(func(tx *redis.Tx) error {
+		status, err := tx.HGet(key, "status").Result()
+		if err == redis.Nil {
+			return errors.New("Report does not exist")
+		} else if err != nil {
+			return err
+		}
+		if status != from {
+			return errors.New("Report is " + status)
+		}
+		now := time.Now().Unix()
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			fields := map[string]interface{}{"status": to, "moderator": moderatorID, "updated_at": now}
+			if note != "" {
+				fields["resolution"] = note
+			}
+			pipe.HMSet(key, fields)
+			pipe.ZRem(reportQueueKey(from), id)
+			pipe.ZAdd(reportQueueKey(to), redis.Z{Score: float64(now), Member: id})
+			return nil
+		})
+		return err
+	}, key)
+}
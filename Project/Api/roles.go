@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Dzdrgl/redis-Api/models"
+	"github.com/gorilla/mux"
+)
+
+// RequireRole lets the request through when the authenticated user holds one of
+// the given roles. Admins pass every role check. It must run inside AuthMiddleware.
+func (h *Handler) RequireRole(next http.HandlerFunc, roles ...models.Role) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value("userInfo").(models.User)
+		if !ok {
+			errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+			return
+		}
+		if !hasRole(user.Role, roles) {
+			log.Printf("RequireRole - user %s with role %s denied", user.ID, user.Role)
+			errorResponse(w, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func hasRole(role models.Role, allowed []models.Role) bool {
+	if role == models.RoleAdmin {
+		return true
+	}
+	for _, r := range allowed {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func roleOrDefault(role models.Role) models.Role {
+	if role == "" {
+		return models.RolePlayer
+	}
+	return role
+}
+
+func validRole(role models.Role) bool {
+	for _, r := range models.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) HandleSetRole(w http.ResponseWriter, r *http.Request) {
+	log.Println("SetRole - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var roleInfo models.RoleInfo
+	if err := json.NewDecoder(r.Body).Decode(&roleInfo); err != nil {
+		log.Printf("SetRole - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	userID := mux.Vars(r)["id"]
+	if err := h.SetUserRole(userID, roleInfo.Role); err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("SetRole - user %s is now %s", userID, roleInfo.Role)
+	successResponse(w, models.SuccessResponse{Status: true, Result: h.FetchUserInfoWithID(userID)})
+}
+
+// SetUserRole changes the role of a user. Existing sessions are closed so the new
+// role is picked up on the next login.
+func (h *Handler) SetUserRole(userID string, role models.Role) error {
+	if !validRole(role) {
+		return errors.New("Invalid role")
+	}
+	if h.FetchUserFieldWithID(userID, "id") == "" {
+		return errors.New(IDNotFound)
+	}
+	if err := h.UpdateUserField(userID, "role", string(role)); err != nil {
+		return err
+	}
+	return h.RevokeUserTokens(userID)
+}
+
+// BootstrapAdmins promotes the configured admin usernames so a fresh install has someone
+// who can manage roles.
+func (h *Handler) BootstrapAdmins() {
+	for _, username := range h.config.AdminUsers {
+		userID := h.GetUserIDWithUsername(username)
+		if userID == "" {
+			log.Printf("BootstrapAdmins - user %s not found", username)
+			continue
+		}
+		if h.FetchUserFieldWithID(userID, "role") == string(models.RoleAdmin) {
+			continue
+		}
+		if err := h.UpdateUserField(userID, "role", string(models.RoleAdmin)); err != nil {
+			log.Printf("BootstrapAdmins - %v", err)
+		}
+	}
+}
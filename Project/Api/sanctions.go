@@ -0,0 +1,282 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Dzdrgl/redis-Api/models"
+	"github.com/go-redis/redis"
+	"github.com/gorilla/mux"
+)
+
+// Account states. A suspension ends by itself at status_until; a ban lasts until lifted.
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+	StatusBanned    = "banned"
+)
+
+const (
+	sanctionedKey  = "sanctioned"
+	bannedUsersKey = "banned_users"
+)
+
+var (
+	ErrAccountSuspended = errors.New("Account is suspended")
+	ErrAccountBanned    = errors.New("Account is banned")
+)
+
+// checkAccountStatus returns an error describing the sanction when the account may not be used.
+func (h *Handler) checkAccountStatus(userID string) error {
+	fields := h.client.HMGet("user:"+userID, "status", "status_until", "status_reason").Val()
+	if len(fields) < 3 {
+		return nil
+	}
+	status, _ := fields[0].(string)
+	until, _ := fields[1].(string)
+	reason, _ := fields[2].(string)
+	return accountStatusError(status, until, reason)
+}
+
+// accountStatusError turns the stored status fields into the error checkAccountStatus reports.
+func accountStatusError(status, until, reason string) error {
+	switch status {
+	case StatusBanned:
+		return fmt.Errorf("%w: %s", ErrAccountBanned, reason)
+	case StatusSuspended:
+		untilUnix, _ := strconv.ParseInt(until, 10, 64)
+		if time.Now().Unix() < untilUnix {
+			return fmt.Errorf("%w until %s: %s", ErrAccountSuspended, formatUnix(until), reason)
+		}
+	}
+	return nil
+}
+
+func (h *Handler) HandleApplySanction(w http.ResponseWriter, r *http.Request) {
+	log.Println("ApplySanction - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var request models.SanctionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("ApplySanction - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	actor, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	sanction, err := h.ApplySanction(mux.Vars(r)["id"], actor, request)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("ApplySanction - user %s %s by %s", sanction.UserID, sanction.Status, actor.ID)
+	successResponse(w, models.SuccessResponse{Status: true, Result: sanction})
+}
+
+func (h *Handler) HandleLiftSanction(w http.ResponseWriter, r *http.Request) {
+	log.Println("LiftSanction - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var request models.SanctionRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.Printf("LiftSanction - Invalid JSON input: %v", err)
+			errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+			return
+		}
+	}
+	actor, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	userID := mux.Vars(r)["id"]
+	if err := h.LiftSanction(userID, actor, request.Reason); err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("LiftSanction - user %s reinstated by %s", userID, actor.ID)
+	successResponse(w, models.SuccessResponse{Status: true, Result: map[string]interface{}{"message": "Sanction lifted"}})
+}
+
+func (h *Handler) HandleListSanctions(w http.ResponseWriter, r *http.Request) {
+	log.Println("ListSanctions - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	sanctions, err := h.ListSanctions()
+	if err != nil {
+		log.Printf("ListSanctions - %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: sanctions})
+}
+
+func (h *Handler) HandleSanctionHistory(w http.ResponseWriter, r *http.Request) {
+	log.Println("SanctionHistory - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var history []models.Sanction
+	entries, err := h.client.LRange("sanctions:"+mux.Vars(r)["id"], 0, -1).Result()
+	if err != nil {
+		log.Printf("SanctionHistory - %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	for _, entry := range entries {
+		var sanction models.Sanction
+		if err := json.Unmarshal([]byte(entry), &sanction); err == nil {
+			history = append(history, sanction)
+		}
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: history})
+}
+
+// ApplySanction suspends or bans a user and closes their sessions. Only admins may
+// sanction moderators and admins.
+func (h *Handler) ApplySanction(userID string, actor models.User, request models.SanctionRequest) (*models.Sanction, error) {
+	target := h.FetchUserInfoWithID(userID)
+	if target.ID == "" {
+		return nil, errors.New(IDNotFound)
+	}
+	if target.ID == actor.ID {
+		return nil, errors.New("Can't sanction yourself")
+	}
+	if target.Role != models.RolePlayer && target.Role != models.RoleGameServer && actor.Role != models.RoleAdmin {
+		return nil, errors.New("Only admins can sanction staff accounts")
+	}
+	if request.Reason == "" {
+		return nil, errors.New("Reason must not be empty")
+	}
+
+	now := time.Now()
+	sanction := &models.Sanction{
+		UserID:    userID,
+		Username:  target.Username,
+		Status:    request.Status,
+		Reason:    request.Reason,
+		Actor:     actor.ID,
+		CreatedAt: now.Format("2006-01-02T15:04:05"),
+	}
+	score := math.Inf(1)
+	var until string
+	switch request.Status {
+	case StatusSuspended:
+		duration, err := time.ParseDuration(request.Duration)
+		if err != nil || duration <= 0 {
+			return nil, errors.New("Suspensions need a positive duration such as 72h")
+		}
+		untilTime := now.Add(duration)
+		score = float64(untilTime.Unix())
+		until = strconv.FormatInt(untilTime.Unix(), 10)
+		sanction.Until = untilTime.Format("2006-01-02T15:04:05")
+	case StatusBanned:
+	default:
+		return nil, errors.New("Status must be suspended or banned")
+	}
+
+	record, err := json.Marshal(sanction)
+	if err != nil {
+		return nil, err
+	}
+	_, err = h.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet("user:"+userID, map[string]interface{}{
+			"status":        request.Status,
+			"status_reason": request.Reason,
+			"status_actor":  actor.ID,
+			"status_until":  until,
+			"status_at":     strconv.FormatInt(now.Unix(), 10),
+		})
+		pipe.ZAdd(sanctionedKey, redis.Z{Score: score, Member: userID})
+		if request.Status == StatusBanned {
+			pipe.SAdd(bannedUsersKey, userID)
+		} else {
+			pipe.SRem(bannedUsersKey, userID)
+		}
+		pipe.LPush("sanctions:"+userID, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sanction, h.RevokeUserTokens(userID)
+}
+
+// LiftSanction returns the account to active and records who lifted it.
+func (h *Handler) LiftSanction(userID string, actor models.User, reason string) error {
+	status := h.FetchUserFieldWithID(userID, "status")
+	if status == "" || status == StatusActive {
+		return errors.New("User has no active sanction")
+	}
+	record, err := json.Marshal(models.Sanction{
+		UserID:    userID,
+		Username:  h.FetchUserFieldWithID(userID, "username"),
+		Status:    StatusActive,
+		Reason:    reason,
+		Actor:     actor.ID,
+		CreatedAt: time.Now().Format("2006-01-02T15:04:05"),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = h.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HDel("user:"+userID, "status", "status_reason", "status_actor", "status_until", "status_at")
+		pipe.ZRem(sanctionedKey, userID)
+		pipe.SRem(bannedUsersKey, userID)
+		pipe.LPush("sanctions:"+userID, record)
+		return nil
+	})
+	return err
+}
+
+// ListSanctions returns the bans and running suspensions, soonest to end first.
+// Suspensions that ran out are dropped from the index on the way.
+func (h *Handler) ListSanctions() ([]models.Sanction, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	h.client.ZRemRangeByScore(sanctionedKey, "-inf", "("+now)
+	ids, err := h.client.ZRangeByScore(sanctionedKey, redis.ZRangeBy{Min: now, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+	var sanctions []models.Sanction
+	for _, id := range ids {
+		fields := h.client.HGetAll("user:" + id).Val()
+		if fields["status"] == "" {
+			continue
+		}
+		sanctions = append(sanctions, models.Sanction{
+			UserID:    id,
+			Username:  fields["username"],
+			Status:    fields["status"],
+			Reason:    fields["status_reason"],
+			Actor:     fields["status_actor"],
+			Until:     formatUnix(fields["status_until"]),
+			CreatedAt: formatUnix(fields["status_at"]),
+		})
+	}
+	return sanctions, nil
+}
+
+// bannedRanks returns the 0-based positions of banned users on the board, ascending.
+func (h *Handler) bannedRanks(board *models.Leaderboard) ([]int64, map[string]bool) {
+	banned := map[string]bool{}
+	var ranks []int64
+	for _, id := range h.client.SMembers(bannedUsersKey).Val() {
+		banned[id] = true
+		if rank, err := h.boardRank(board, id); err == nil {
+			ranks = append(ranks, rank)
+		}
+	}
+	sort.Slice(ranks, func(i, j int) bool { return ranks[i] < ranks[j] })
+	return ranks, banned
+}
@@ -0,0 +1,400 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Dzdrgl/redis-Api/models"
+	"github.com/go-redis/redis"
+	"github.com/gorilla/mux"
+)
+
+// Seasons live in season:<id> and are indexed in the "seasons" sorted set by start
+// time. season_current holds the running season. When it ends, every board's
+// all-time scores are copied to season:<id>:board:<board> and cut down to the
+// season's carry-over percentage. season:<id>:boards records the boards already
+// archived so an interrupted rollover resumes without archiving a board twice.
+//
+// The first season starts from empty boards: the scores from before it are kept in
+// season:<id>:preseason:board:<board>. Later seasons start from the previous season's
+// carry-over, and points scored in a gap between two seasons count towards the next one.
+const (
+	SeasonScheduled = "scheduled"
+	SeasonActive    = "active"
+	SeasonArchiving = "archiving"
+	SeasonArchived  = "archived"
+
+	seasonTimeLayout  = "2006-01-02T15:04:05"
+	seasonLockTimeout = 5 * time.Minute
+)
+
+var (
+	ErrUnknownSeason = errors.New("Season does not exist")
+	ErrSeasonBusy    = errors.New("Another season rollover is running")
+)
+
+// releaseLockScript deletes the lock only while it still holds our token.
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// archiveBoardScript freezes one board into the season archive and applies the soft reset.
+// KEYS: board, archive, archived boards set. ARGV: carry-over percent, board id.
+var archiveBoardScript = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[3], ARGV[2]) == 1 then
+	return 0
+end
+local entries = redis.call('ZRANGE', KEYS[1], 0, -1, 'WITHSCORES')
+local percent = tonumber(ARGV[1])
+redis.call('DEL', KEYS[2])
+for i = 1, #entries, 2 do
+	local score = tonumber(entries[i + 1])
+	redis.call('ZADD', KEYS[2], score, entries[i])
+	local kept = math.floor(score * percent / 100)
+	if kept > 0 then
+		redis.call('ZADD', KEYS[1], kept, entries[i])
+	else
+		redis.call('ZREM', KEYS[1], entries[i])
+	end
+end
+redis.call('SADD', KEYS[3], ARGV[2])
+return 1
+`)
+
+func seasonBoard(board *models.Leaderboard, seasonID string) *models.Leaderboard {
+	archived := *board
+	archived.Season = seasonID
+	return &archived
+}
+
+func (h *Handler) FetchSeason(id string) (*models.Season, error) {
+	fields := h.client.HGetAll("season:" + id).Val()
+	if fields["id"] == "" {
+		return nil, ErrUnknownSeason
+	}
+	season := &models.Season{
+		ID:         fields["id"],
+		Name:       fields["name"],
+		Start:      formatUnix(fields["start"]),
+		End:        formatUnix(fields["end"]),
+		Status:     fields["status"],
+		ArchivedAt: formatUnix(fields["archived_at"]),
+	}
+	season.CarryOver, _ = strconv.Atoi(fields["carry_over"])
+	return season, nil
+}
+
+func seasonTimes(fields map[string]string) (time.Time, time.Time) {
+	start, _ := strconv.ParseInt(fields["start"], 10, 64)
+	end, _ := strconv.ParseInt(fields["end"], 10, 64)
+	return time.Unix(start, 0), time.Unix(end, 0)
+}
+
+// ListSeasons returns every season, oldest first.
+func (h *Handler) ListSeasons() ([]*models.Season, error) {
+	ids, err := h.client.ZRange("seasons", 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	var seasons []*models.Season
+	for _, id := range ids {
+		if season, err := h.FetchSeason(id); err == nil {
+			seasons = append(seasons, season)
+		}
+	}
+	return seasons, nil
+}
+
+// CreateSeason schedules a season. Seasons may not overlap.
+func (h *Handler) CreateSeason(request *models.Season) (*models.Season, error) {
+	var violations []string
+	start, err := time.ParseInLocation(seasonTimeLayout, request.Start, time.Local)
+	if err != nil {
+		violations = append(violations, "Start must be a time in 2006-01-02T15:04:05 format")
+	}
+	end, err := time.ParseInLocation(seasonTimeLayout, request.End, time.Local)
+	if err != nil {
+		violations = append(violations, "End must be a time in 2006-01-02T15:04:05 format")
+	} else if !end.After(start) || !end.After(time.Now()) {
+		violations = append(violations, "End must be after the start and in the future")
+	}
+	if request.Name == "" || len(request.Name) > 100 {
+		violations = append(violations, "Name must be between 1 and 100 characters")
+	}
+	if request.CarryOver < 0 || request.CarryOver > 100 {
+		violations = append(violations, "Carry over must be a percentage between 0 and 100")
+	}
+	if len(violations) > 0 {
+		return nil, &ValidationError{Message: "Invalid season", Violations: violations}
+	}
+	ids, err := h.client.ZRange("seasons", 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		fields := h.client.HGetAll("season:" + id).Val()
+		otherStart, otherEnd := seasonTimes(fields)
+		if fields["status"] != SeasonArchived && start.Before(otherEnd) && otherStart.Before(end) {
+			return nil, errors.New("Season overlaps season " + id)
+		}
+	}
+
+	id := strconv.FormatInt(h.client.Incr("season_id").Val(), 10)
+	_, err = h.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet("season:"+id, map[string]interface{}{
+			"id":         id,
+			"name":       request.Name,
+			"start":      start.Unix(),
+			"end":        end.Unix(),
+			"carry_over": request.CarryOver,
+			"status":     SeasonScheduled,
+		})
+		pipe.ZAdd("seasons", redis.Z{Score: float64(start.Unix()), Member: id})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h.FetchSeason(id)
+}
+
+// RunSeasonWorker rolls seasons over every interval. It is meant to run in its own goroutine.
+func (h *Handler) RunSeasonWorker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := h.RolloverSeasons(); err != nil && !errors.Is(err, ErrSeasonBusy) {
+			log.Printf("RolloverSeasons - %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// RolloverSeasons archives the current season once it has ended and starts the next
+// scheduled season whose start has come. A lock keeps two instances from doing it at
+// once; ErrSeasonBusy means another instance holds it.
+func (h *Handler) RolloverSeasons() error {
+	token, err := h.randomToken()
+	if err != nil {
+		return err
+	}
+	if !h.client.SetNX("season_lock", token, seasonLockTimeout).Val() {
+		return ErrSeasonBusy
+	}
+	defer releaseLockScript.Run(h.client, []string{"season_lock"}, token)
+
+	now := time.Now()
+	if current := h.client.Get("season_current").Val(); current != "" {
+		fields := h.client.HGetAll("season:" + current).Val()
+		_, end := seasonTimes(fields)
+		if fields["status"] == SeasonArchiving || !now.Before(end) {
+			if err := h.archiveSeason(current, fields); err != nil {
+				return err
+			}
+		} else {
+			return nil
+		}
+	}
+
+	due, err := h.client.ZRangeByScore("seasons", redis.ZRangeBy{Min: "-inf", Max: strconv.FormatInt(now.Unix(), 10)}).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range due {
+		fields := h.client.HGetAll("season:" + id).Val()
+		_, end := seasonTimes(fields)
+		if fields["status"] != SeasonScheduled || !now.Before(end) {
+			continue
+		}
+		if err := h.startSeason(id); err != nil {
+			return err
+		}
+		h.client.HSet("season:"+id, "status", SeasonActive)
+		h.client.Set("season_current", id, 0)
+		log.Printf("RolloverSeasons - season %s started", id)
+		break
+	}
+	return nil
+}
+
+// startSeason clears the boards before the first season so it does not inherit scores
+// from before seasons existed. The old scores are kept as a read-only snapshot.
+func (h *Handler) startSeason(id string) error {
+	seasons, err := h.ListSeasons()
+	if err != nil {
+		return err
+	}
+	for _, season := range seasons {
+		if season.ID != id && season.Status != SeasonScheduled {
+			return nil
+		}
+	}
+	boards, err := h.ListLeaderboards()
+	if err != nil {
+		return err
+	}
+	for _, board := range boards {
+		keys := []string{boardKey(board), "season:" + id + ":preseason:board:" + board.ID, "season:" + id + ":preseason"}
+		if err := archiveBoardScript.Run(h.client, keys, 0, board.ID).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handler) archiveSeason(id string, fields map[string]string) error {
+	h.client.HSet("season:"+id, "status", SeasonArchiving)
+	carryOver, _ := strconv.Atoi(fields["carry_over"])
+	boards, err := h.ListLeaderboards()
+	if err != nil {
+		return err
+	}
+	for _, board := range boards {
+		percent := carryOver
+		if board.SortOrder == SortAsc {
+			// Carrying over a fraction of a lower-is-better score would reward it.
+			percent = 0
+		}
+		keys := []string{boardKey(board), boardKey(seasonBoard(board, id)), "season:" + id + ":boards"}
+		if err := archiveBoardScript.Run(h.client, keys, percent, board.ID).Err(); err != nil {
+			return err
+		}
+	}
+	_, err = h.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet("season:"+id, map[string]interface{}{"status": SeasonArchived, "archived_at": time.Now().Unix()})
+		pipe.Del("season_current")
+		return nil
+	})
+	if err == nil {
+		log.Printf("RolloverSeasons - season %s archived", id)
+	}
+	return err
+}
+
+// archivedBoard returns the frozen copy of a board for an archived season.
+func (h *Handler) archivedBoard(board *models.Leaderboard, seasonID string) (*models.Leaderboard, error) {
+	if h.client.HGet("season:"+seasonID, "status").Val() != SeasonArchived ||
+		!h.client.SIsMember("season:"+seasonID+":boards", board.ID).Val() {
+		return nil, errors.New("No archived standings for this season and leaderboard")
+	}
+	return seasonBoard(board, seasonID), nil
+}
+
+// FetchSeasonStandings returns the user's final score and rank on every board of every archived season.
+func (h *Handler) FetchSeasonStandings(userID string) ([]models.SeasonStanding, error) {
+	seasons, err := h.ListSeasons()
+	if err != nil {
+		return nil, err
+	}
+	var standings []models.SeasonStanding
+	for _, season := range seasons {
+		if season.Status != SeasonArchived {
+			continue
+		}
+		for _, boardID := range h.client.SMembers("season:" + season.ID + ":boards").Val() {
+			board, err := h.FetchLeaderboard(boardID)
+			if err != nil {
+				// The board was deleted later; its archive keeps the default settings.
+				board = &models.Leaderboard{ID: boardID, SortOrder: SortDesc}
+			}
+			score, rank := h.FetchStanding(seasonBoard(board, season.ID), userID)
+			if rank == 0 {
+				continue
+			}
+			standings = append(standings, models.SeasonStanding{
+				SeasonID:    season.ID,
+				SeasonName:  season.Name,
+				Leaderboard: boardID,
+				Score:       score,
+				Rank:        rank,
+			})
+		}
+	}
+	return standings, nil
+}
+
+func (h *Handler) HandleListSeasons(w http.ResponseWriter, r *http.Request) {
+	log.Println("ListSeasons - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	seasons, err := h.ListSeasons()
+	if err != nil {
+		log.Printf("ListSeasons - %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: seasons})
+}
+
+func (h *Handler) HandleCreateSeason(w http.ResponseWriter, r *http.Request) {
+	log.Println("CreateSeason - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var request models.Season
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("CreateSeason - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	season, err := h.CreateSeason(&request)
+	if err != nil {
+		writeUserError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := h.RolloverSeasons(); err != nil && !errors.Is(err, ErrSeasonBusy) {
+		log.Printf("CreateSeason - %v", err)
+	}
+	log.Printf("CreateSeason - season %s scheduled", season.ID)
+	successResponse(w, models.SuccessResponse{Status: true, Result: season})
+}
+
+func (h *Handler) HandleEndSeason(w http.ResponseWriter, r *http.Request) {
+	log.Println("EndSeason - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	id := mux.Vars(r)["season"]
+	if h.client.Get("season_current").Val() != id {
+		errorResponse(w, http.StatusBadRequest, "Only the running season can be ended")
+		return
+	}
+	h.client.HSet("season:"+id, "end", time.Now().Unix())
+	err := h.RolloverSeasons()
+	if err != nil && !errors.Is(err, ErrSeasonBusy) {
+		log.Printf("EndSeason - %v", err)
+		errorResponse(w, http.StatusInternalServerError, "Could not archive the season")
+		return
+	}
+	season, _ := h.FetchSeason(id)
+	if season.Status != SeasonArchived {
+		// The running worker archives the season on its next pass.
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(models.SuccessResponse{Status: true, Result: season})
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: season})
+}
+
+func (h *Handler) HandleSeasonStandings(w http.ResponseWriter, r *http.Request) {
+	log.Println("SeasonStandings - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	userID := mux.Vars(r)["id"]
+	if h.FetchUserFieldWithID(userID, "username") == "" {
+		errorResponse(w, http.StatusNotFound, "User does not exist")
+		return
+	}
+	standings, err := h.FetchSeasonStandings(userID)
+	if err != nil {
+		log.Printf("SeasonStandings - %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: standings})
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B SHA-1 vectors, truncated to the six digits issued here.
+func TestTOTPCodeRFC6238(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		code, err := totpCode(secret, v.unix/totpPeriod)
+		if err != nil {
+			t.Fatalf("totpCode(%d): %v", v.unix, err)
+		}
+		if code != v.code {
+			t.Errorf("totpCode(%d) = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestMatchTOTPSkew(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+	for _, offset := range []int64{-1, 0, 1} {
+		code, _ := totpCode(secret, step+offset)
+		if got := matchTOTP(secret, code, now); got != step+offset {
+			t.Errorf("matchTOTP with offset %d = %d, want %d", offset, got, step+offset)
+		}
+	}
+	code, _ := totpCode(secret, step+2)
+	if got := matchTOTP(secret, code, now); got != -1 {
+		t.Errorf("matchTOTP outside the skew = %d, want -1", got)
+	}
+}
@@ -2,10 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
 	models "github.com/Dzdrgl/redis-Api/models"
+	"github.com/gorilla/mux"
 )
 
 func (h *Handler) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
@@ -22,21 +24,18 @@ func (h *Handler) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
 		errorResponse(w, http.StatusBadRequest, "Username and password must not be empty")
 		return
 	}
+	// Sign-up only chooses the name, password and profile. Roles are granted through the admin endpoint.
+	newUser.ID, newUser.Token, newUser.SessionID = "", "", ""
+	newUser.Role = models.RolePlayer
+	newUser.CreatedAt, newUser.UpdatedAt = "", ""
 	if err := h.CreateUser(&newUser, ""); err != nil {
-		errorResponse(w, http.StatusInternalServerError, err.Error())
+		writeUserError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	result := models.User{
-		ID:       newUser.ID,
-		Username: newUser.Username,
-		Name:     newUser.Name,
-		Surname:  newUser.Surname,
-	}
-
 	userResult := models.SuccessResponse{
 		Status: true,
-		Result: result,
+		Result: h.FetchUserInfoWithID(newUser.ID),
 	}
 	successResponse(w, userResult)
 }
@@ -45,24 +44,66 @@ func (h *Handler) HandleRetrieveUser(w http.ResponseWriter, r *http.Request) {
 	log.Println("RetriveUser - called")
 	w.Header().Set(ContentType, ApplicationJSON)
 
-	_, ok := r.Context().Value("userInfo").(models.User)
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
 	if !ok {
 		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
 		return
 	}
-	userIDFromURL := r.URL.Path[len("/api/v2/users/"):]
-	user := h.FetchUserInfoWithID(userIDFromURL)
+	user := h.FetchUserInfoWithID(mux.Vars(r)["id"])
 	if user.Username == "" {
 		errorResponse(w, http.StatusNotFound, "User does not exist")
 		return
 	}
 	response := models.SuccessResponse{
 		Status: true,
-		Result: user,
+		Result: h.VisibleProfile(user, currentUser.ID),
 	}
 	successResponse(w, response)
 }
 
+func (h *Handler) HandleMe(w http.ResponseWriter, r *http.Request) {
+	log.Println("Me - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	profile := models.Profile{User: *h.FetchUserInfoWithID(currentUser.ID)}
+	if board, err := h.FetchLeaderboard(DefaultLeaderboard); err == nil {
+		profile.Score, profile.Rank = h.FetchStanding(board, currentUser.ID)
+	}
+	if standings, err := h.FetchStandings(currentUser.ID); err == nil {
+		profile.Standings = standings
+	} else {
+		log.Printf("Me - %v", err)
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: profile})
+}
+
+func (h *Handler) HandleUserByUsername(w http.ResponseWriter, r *http.Request) {
+	log.Println("UserByUsername - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	userID := h.GetUserIDWithUsername(mux.Vars(r)["name"])
+	if userID == "" {
+		errorResponse(w, http.StatusNotFound, "Username does not exist")
+		return
+	}
+	user := h.FetchUserInfoWithID(userID)
+	if user.Username == "" {
+		errorResponse(w, http.StatusNotFound, "Username does not exist")
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: h.VisibleProfile(user, currentUser.ID)})
+}
+
 func (h *Handler) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
 	log.Println("UpdateUser - called")
 	w.Header().Set(ContentType, ApplicationJSON)
@@ -79,9 +120,13 @@ func (h *Handler) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	updatedUser, err := h.UpdateUser(&newInfo, user.ID)
+	if errors.Is(err, ErrUsernameCooldown) {
+		errorResponse(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
 	if err != nil {
 		log.Printf("UpdateUser - Internal Server Error: %v", err)
-		errorResponse(w, http.StatusInternalServerError, err.Error())
+		writeUserError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -96,7 +141,7 @@ func (h *Handler) HandleUserLogin(w http.ResponseWriter, r *http.Request) {
 	log.Println("UserLogin - Called")
 	w.Header().Set(ContentType, ApplicationJSON)
 
-	var creds models.User
+	var creds models.LoginInfo
 	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
 		log.Printf("UpdateUser - Invalid JSON format: %v", err)
 		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
@@ -107,19 +152,28 @@ func (h *Handler) HandleUserLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.UserLogin(creds.Username, creds.Password)
+	session := models.Session{
+		Device:    creds.Device,
+		IP:        h.clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	tokens, err := h.UserLogin(creds.Username, creds.Password, session)
+	if errors.Is(err, ErrAccountPendingDeletion) || errors.Is(err, ErrAccountSuspended) || errors.Is(err, ErrAccountBanned) {
+		errorResponse(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if errors.Is(err, ErrLoginLocked) {
+		errorResponse(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
 	if err != nil {
 		errorResponse(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	userMap := map[string]interface{}{
-		"Token": token,
-	}
-
 	userResult := models.SuccessResponse{
 		Status: true,
-		Result: userMap,
+		Result: tokens,
 	}
 	successResponse(w, userResult)
 }
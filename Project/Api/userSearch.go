@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Dzdrgl/redis-Api/models"
+	"github.com/go-redis/redis"
+)
+
+const (
+	searchIndexKey = "user_search"
+	// legacySearchIndexKey indexed names regardless of privacy and is dropped on rebuild.
+	legacySearchIndexKey = "search_index"
+	searchScanBatch      = 100
+	maxSearchResults     = 50
+)
+
+// The search index is a sorted set with every score at 0, so members sort
+// lexicographically and ZRANGEBYLEX answers prefix queries. Each member is a
+// lowercased term followed by ":" and the user id. Names of private profiles are
+// left out so they can't be found by their real name.
+func searchTerms(user *models.User) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, term := range displayTerms(user) {
+		term = strings.ToLower(strings.TrimSpace(term))
+		if term != "" && !seen[term] {
+			seen[term] = true
+			terms = append(terms, term+":"+user.ID)
+		}
+	}
+	return terms
+}
+
+func displayTerms(user *models.User) []string {
+	terms := []string{user.Username}
+	if privacyOrDefault(user.Privacy) != PrivacyPrivate {
+		terms = append(terms, user.Name, user.Surname, strings.TrimSpace(user.Name+" "+user.Surname))
+	}
+	return terms
+}
+
+// visibleMatch reports whether one of the fields the viewer can see starts with prefix.
+func visibleMatch(visible *models.User, prefix string) bool {
+	for _, term := range []string{visible.Username, visible.Name, visible.Surname, strings.TrimSpace(visible.Name + " " + visible.Surname)} {
+		if term != "" && strings.HasPrefix(strings.ToLower(term), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IndexUser replaces the search terms of old with those of user. old may be nil.
+func (h *Handler) IndexUser(old, user *models.User) error {
+	pipe := h.client.TxPipeline()
+	if old != nil {
+		for _, member := range searchTerms(old) {
+			pipe.ZRem(searchIndexKey, member)
+		}
+	}
+	if user != nil {
+		for _, member := range searchTerms(user) {
+			pipe.ZAdd(searchIndexKey, redis.Z{Member: member})
+		}
+	}
+	_, err := pipe.Exec()
+	return err
+}
+
+// RebuildSearchIndex indexes every stored user. It runs at startup when the index is missing.
+func (h *Handler) RebuildSearchIndex() error {
+	h.client.Del(legacySearchIndexKey)
+	if h.client.Exists(searchIndexKey).Val() == 1 {
+		return nil
+	}
+	return h.scanKeys("user:*", func(key string) error {
+		user := mapToUser(h.client.HGetAll(key).Val())
+		if user.ID == "" || user.Username == "" {
+			return nil
+		}
+		return h.IndexUser(nil, user)
+	})
+}
+
+func (h *Handler) HandleSearchUsers(w http.ResponseWriter, r *http.Request) {
+	log.Println("SearchUsers - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	var searchInfo models.SearchInfo
+	if err := json.NewDecoder(r.Body).Decode(&searchInfo); err != nil {
+		log.Printf("SearchUsers - Invalid JSON input: %v", err)
+		errorResponse(w, http.StatusBadRequest, InvalidJSONInputMsg)
+		return
+	}
+	currentUser, ok := r.Context().Value("userInfo").(models.User)
+	if !ok {
+		errorResponse(w, http.StatusUnauthorized, "User info not found in context")
+		return
+	}
+	if strings.TrimSpace(searchInfo.Query) == "" {
+		errorResponse(w, http.StatusBadRequest, "Query must not be empty")
+		return
+	}
+	if searchInfo.Count <= 0 || searchInfo.Count > maxSearchResults || searchInfo.Page <= 0 {
+		errorResponse(w, http.StatusBadRequest, "Invalid page or count value")
+		return
+	}
+	users, err := h.SearchUsers(searchInfo, currentUser.ID)
+	if err != nil {
+		log.Printf("SearchUsers - %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: users})
+}
+
+// SearchUsers returns one page of users whose username or display name starts with
+// the query, leaving out the viewer and anyone blocked in either direction. Friends-only
+// names are indexed, so a match only counts when the viewer can see the matching field.
+func (h *Handler) SearchUsers(searchInfo models.SearchInfo, viewerID string) ([]*models.User, error) {
+	prefix := strings.ToLower(strings.TrimSpace(searchInfo.Query))
+	skip := searchInfo.Count * (searchInfo.Page - 1)
+	seen := map[string]bool{}
+	var users []*models.User
+
+	for offset := int64(0); int64(len(users)) < searchInfo.Count; offset += searchScanBatch {
+		members, err := h.client.ZRangeByLex(searchIndexKey, redis.ZRangeBy{
+			Min:    "[" + prefix,
+			Max:    "[" + prefix + "\xff",
+			Offset: offset,
+			Count:  searchScanBatch,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			userID := member[strings.LastIndex(member, ":")+1:]
+			if seen[userID] || userID == viewerID {
+				continue
+			}
+			seen[userID] = true
+			if h.IsBlocked(viewerID, userID) {
+				continue
+			}
+			user := h.FetchUserInfoWithID(userID)
+			if user.Username == "" {
+				continue
+			}
+			visible := h.VisibleProfile(user, viewerID)
+			if !visibleMatch(visible, prefix) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			users = append(users, visible)
+			if int64(len(users)) == searchInfo.Count {
+				break
+			}
+		}
+		if len(members) < searchScanBatch {
+			break
+		}
+	}
+	return users, nil
+}
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dzdrgl/redis-Api/models"
+	"github.com/go-redis/redis"
+	"github.com/gorilla/mux"
+)
+
+var (
+	ErrUsernameTaken    = errors.New(UsernameAlreadyExists)
+	ErrUsernameCooldown = errors.New("Username was changed recently")
+)
+
+// createUserScript claims the username and writes the user hash in one step.
+// KEYS: username index, user hash, username hold. ARGV: user id, then field/value pairs.
+var createUserScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 or redis.call('EXISTS', KEYS[3]) == 1 then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1])
+redis.call('HMSET', KEYS[2], unpack(ARGV, 2))
+return 1
+`)
+
+// renameUserScript moves the username index entry and the hash field together,
+// records the old name and holds it for the previous owner.
+// KEYS: new index, old index, legacy old index, user hash, new hold, old hold, history.
+// ARGV: user id, new name, old name, now, cooldown seconds, hold seconds, history entry.
+// Returns 0 when the new name belongs to someone else, -1 when the user was renamed
+// meanwhile and -2 while the cooldown runs.
+var renameUserScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner and owner ~= ARGV[1] then
+	return 0
+end
+local holder = redis.call('GET', KEYS[5])
+if holder and holder ~= ARGV[1] then
+	return 0
+end
+if redis.call('HGET', KEYS[4], 'username') ~= ARGV[3] then
+	return -1
+end
+local changed = tonumber(redis.call('HGET', KEYS[4], 'username_changed_at') or '0')
+if changed + tonumber(ARGV[5]) > tonumber(ARGV[4]) then
+	return -2
+end
+for i = 2, 3 do
+	if KEYS[i] ~= KEYS[1] and redis.call('GET', KEYS[i]) == ARGV[1] then
+		redis.call('DEL', KEYS[i])
+	end
+end
+redis.call('DEL', KEYS[5])
+redis.call('SET', KEYS[1], ARGV[1])
+redis.call('HSET', KEYS[4], 'username', ARGV[2], 'username_changed_at', ARGV[4])
+if tonumber(ARGV[6]) > 0 and KEYS[6] ~= KEYS[5] then
+	redis.call('SET', KEYS[6], ARGV[1], 'EX', ARGV[6])
+end
+redis.call('LPUSH', KEYS[7], ARGV[7])
+return 1
+`)
+
+func usernameHoldKey(username string) string {
+	return "username_hold:" + normalizeUsername(username)
+}
+
+// RenameUser atomically points the username index at the user under the new name.
+// The old name goes to the user's history and stays held for UsernameHoldPeriod.
+func (h *Handler) RenameUser(id, oldName, newName string) error {
+	now := time.Now()
+	entry, err := json.Marshal(models.UsernameChange{Username: oldName, ChangedAt: now.Format("2006-01-02T15:04:05")})
+	if err != nil {
+		return err
+	}
+	keys := []string{
+		usernameKey(newName), usernameKey(oldName), "username:" + oldName, "user:" + id,
+		usernameHoldKey(newName), usernameHoldKey(oldName), "usernames:" + id,
+	}
+	result, err := renameUserScript.Run(h.client, keys, id, newName, oldName, now.Unix(),
+		int64(h.config.UsernameChangeCooldown.Seconds()), int64(h.config.UsernameHoldPeriod.Seconds()), entry).Int()
+	if err != nil {
+		return err
+	}
+	switch result {
+	case 0:
+		return ErrUsernameTaken
+	case -1:
+		return errors.New("Username was changed by another request, try again")
+	case -2:
+		changed, _ := strconv.ParseInt(h.FetchUserFieldWithID(id, "username_changed_at"), 10, 64)
+		wait := time.Unix(changed, 0).Add(h.config.UsernameChangeCooldown).Sub(now).Round(time.Minute)
+		return fmt.Errorf("%w, try again in %s", ErrUsernameCooldown, wait)
+	}
+	return nil
+}
+
+func (h *Handler) HandleUsernameHistory(w http.ResponseWriter, r *http.Request) {
+	log.Println("UsernameHistory - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	userID := mux.Vars(r)["id"]
+	if h.FetchUserFieldWithID(userID, "username") == "" {
+		errorResponse(w, http.StatusNotFound, "User does not exist")
+		return
+	}
+	history, err := h.FetchUsernameHistory(userID)
+	if err != nil {
+		log.Printf("UsernameHistory - %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: history})
+}
+
+// FetchUsernameHistory returns the names the user gave up, newest first.
+func (h *Handler) FetchUsernameHistory(userID string) ([]models.UsernameChange, error) {
+	var history []models.UsernameChange
+	entries, err := h.client.LRange("usernames:"+userID, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		var change models.UsernameChange
+		if err := json.Unmarshal([]byte(entry), &change); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, nil
+}
+
+// migrateLegacyScript moves a username entry written before names were normalized to
+// its normalized key. KEYS: legacy entry, normalized entry. ARGV: user id.
+// Returns 0 when the normalized name belongs to another user.
+var migrateLegacyScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 1
+end
+local owner = redis.call('GET', KEYS[2])
+if owner and owner ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[2], ARGV[1])
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+func (h *Handler) migrateLegacyUsername(key, userID, username string) (bool, error) {
+	result, err := migrateLegacyScript.Run(h.client, []string{key, usernameKey(username)}, userID).Int()
+	return result == 1, err
+}
+
+// MigrateLegacyUsernames moves every entry that predates normalization to its
+// normalized key. Entries whose normalized name is held by someone else are logged and
+// left for an admin; the consistency checker lists them as conflicts.
+func (h *Handler) MigrateLegacyUsernames() error {
+	return h.scanKeys("username:*", func(key string) error {
+		userID := h.client.Get(key).Val()
+		username := h.FetchUserFieldWithID(userID, "username")
+		if username == "" || key != "username:"+username || key == usernameKey(username) {
+			return nil
+		}
+		migrated, err := h.migrateLegacyUsername(key, userID, username)
+		if err == nil && !migrated {
+			log.Printf("MigrateLegacyUsernames - %s conflicts with another user", username)
+		}
+		return err
+	})
+}
+
+func (h *Handler) HandleCheckUsernameIndex(w http.ResponseWriter, r *http.Request) {
+	log.Println("CheckUsernameIndex - Called")
+	w.Header().Set(ContentType, ApplicationJSON)
+
+	repair := r.URL.Query().Get("repair") == "true"
+	report, err := h.CheckUsernameIndex(repair)
+	if err != nil {
+		log.Printf("CheckUsernameIndex - %v", err)
+		errorResponse(w, http.StatusInternalServerError, InternalServerErrorMsg)
+		return
+	}
+	successResponse(w, models.SuccessResponse{Status: true, Result: report})
+}
+
+// CheckUsernameIndex compares every username: entry with the user hashes. With repair
+// set it drops entries that point nowhere and recreates missing ones. Two users sharing
+// a name are only reported, as one of them has to be renamed by hand.
+func (h *Handler) CheckUsernameIndex(repair bool) (*models.ConsistencyReport, error) {
+	report := &models.ConsistencyReport{}
+
+	err := h.scanKeys("username:*", func(key string) error {
+		report.IndexEntries++
+		userID := h.client.Get(key).Val()
+		username := h.FetchUserFieldWithID(userID, "username")
+		if username != "" && usernameKey(username) == key {
+			return nil
+		}
+		if username != "" && key == "username:"+username {
+			// Legacy entry that predates normalization.
+			report.StaleEntries = append(report.StaleEntries, key)
+			if !repair {
+				return nil
+			}
+			migrated, err := h.migrateLegacyUsername(key, userID, username)
+			if err != nil {
+				return err
+			}
+			if migrated {
+				report.Repaired++
+			} else {
+				report.Conflicts = append(report.Conflicts, username+" ("+h.client.Get(usernameKey(username)).Val()+", "+userID+")")
+			}
+			return nil
+		}
+		report.StaleEntries = append(report.StaleEntries, key)
+		if repair {
+			report.Repaired++
+			return h.client.Del(key).Err()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.scanKeys("user:*", func(key string) error {
+		fields, err := h.client.HMGet(key, "id", "username").Result()
+		if err != nil {
+			return nil
+		}
+		userID, _ := fields[0].(string)
+		username, _ := fields[1].(string)
+		if userID == "" || username == "" {
+			return nil
+		}
+		report.Users++
+		owner := h.client.Get(usernameKey(username)).Val()
+		switch {
+		case owner == userID:
+			return nil
+		case owner == "":
+			report.MissingEntries = append(report.MissingEntries, username)
+			if repair {
+				if h.client.SetNX(usernameKey(username), userID, 0).Val() {
+					report.Repaired++
+				}
+			}
+		default:
+			report.Conflicts = append(report.Conflicts, username+" ("+owner+", "+userID+")")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (h *Handler) scanKeys(pattern string, fn func(key string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := h.client.Scan(cursor, pattern, 100).Result()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if strings.Count(key, ":") != 1 {
+				continue
+			}
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
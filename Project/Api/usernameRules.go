@@ -0,0 +1,93 @@
+package api
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed blockedWords.txt
+var blockedWordList string
+
+// UsernameFilter decides whether a username is acceptable beyond the format rules,
+// e.g. by rejecting offensive words. It returns a reason when the name is refused.
+type UsernameFilter interface {
+	Check(username string) (string, bool)
+}
+
+// BlocklistFilter refuses names containing a listed word, also when letters are
+// swapped for look-alike digits or symbols.
+type BlocklistFilter struct {
+	Words []string
+}
+
+var leetReplacer = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "_", "", "-", "", ".", "")
+
+func (f BlocklistFilter) Check(username string) (string, bool) {
+	folded := leetReplacer.Replace(strings.ToLower(username))
+	for _, word := range f.Words {
+		if strings.Contains(folded, word) {
+			return "Username contains a word that is not allowed", false
+		}
+	}
+	return "", true
+}
+
+func defaultUsernameFilter() UsernameFilter {
+	return BlocklistFilter{Words: loadWordList(blockedWordList)}
+}
+
+func loadWordList(list string) []string {
+	var words []string
+	for _, line := range strings.Split(list, "\n") {
+		if line = strings.TrimSpace(strings.ToLower(line)); line != "" {
+			words = append(words, line)
+		}
+	}
+	return words
+}
+
+// reservedPattern covers names the system hands out itself, like simulator players.
+var reservedPattern = regexp.MustCompile(`^player_[0-9]+$`)
+
+// normalizeUsername is the form used for the username: index, so names that differ
+// only by case or surrounding space collide.
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func usernameKey(username string) string {
+	return "username:" + normalizeUsername(username)
+}
+
+// ValidateUsername checks the configured format, the reserved names and the word filter.
+func (h *Handler) ValidateUsername(username string) error {
+	var violations []string
+	length := utf8.RuneCountInString(username)
+	if length < h.config.UsernameMinLength || length > h.config.UsernameMaxLength {
+		violations = append(violations, fmt.Sprintf("Username must be %d to %d characters", h.config.UsernameMinLength, h.config.UsernameMaxLength))
+	}
+	if h.config.UsernamePattern != nil && !h.config.UsernamePattern.MatchString(username) {
+		violations = append(violations, "Username contains characters that are not allowed")
+	}
+	normalized := normalizeUsername(username)
+	if containsString(h.config.ReservedUsernames, normalized) || reservedPattern.MatchString(normalized) {
+		violations = append(violations, "Username is reserved")
+	}
+	if h.usernameFilter != nil {
+		if reason, ok := h.usernameFilter.Check(username); !ok {
+			violations = append(violations, reason)
+		}
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Message: "Invalid username", Violations: violations}
+	}
+	return nil
+}
+
+// SetUsernameFilter replaces the default blocklist filter.
+func (h *Handler) SetUsernameFilter(filter UsernameFilter) {
+	h.usernameFilter = filter
+}
@@ -2,18 +2,23 @@ package api
 
 import (
 	"context"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis"
-	"golang.org/x/crypto/bcrypt"
 
 	models "github.com/Dzdrgl/redis-Api/models"
 )
@@ -23,6 +28,7 @@ const (
 	ContentType            = "Content-Type"
 	ApplicationJSON        = "application/json"
 	InvalidTokenMsg        = "Invalid token"
+	TokenExpiredMsg        = "Token expired"
 	InvalidJSONInputMsg    = "Invalid JSON input"
 	MethodNotAllowedMsg    = "Method not allowed"
 	InternalServerErrorMsg = "Internal server error"
@@ -31,6 +37,12 @@ const (
 	IDNotFound             = "User Id not found"
 )
 
+const minTokenBytes = 16
+
+// tokenExpiryGrace keeps a token key this long past its deadline so ValidateToken can
+// still read it and answer ErrTokenExpired instead of ErrInvalidToken.
+const tokenExpiryGrace = 24 * time.Hour
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -38,44 +50,100 @@ func init() {
 type IHandler interface {
 	StoreUser(newUser *models.User) error
 	CreateUser(newUser *models.User) error
-	UserLogin(username, password string) (string, error)
+	UserLogin(username, password string, session models.Session) (*models.AuthTokens, error)
 }
 
 type Handler struct {
-	client *redis.Client
+	client       *redis.Client
+	config       Config
+	notifier     Notifier
+	hasher       PasswordHasher
+	knownHashers []PasswordHasher
+	// dummyHash is compared against when the username does not exist. It comes from the
+	// configured hasher so unknown names take as long as real ones.
+	dummyHash      string
+	usernameFilter UsernameFilter
 }
 
-func NewHandler(redisClient *redis.Client) *Handler {
+func NewHandler(redisClient *redis.Client, config Config) *Handler {
+	hasher, knownHashers := newPasswordHasher(config)
+	dummyHash, err := hasher.Hash("dummy password for unknown users")
+	if err != nil {
+		log.Printf("NewHandler - could not create dummy password hash: %v", err)
+	}
 	return &Handler{
-		client: redisClient,
+		client:         redisClient,
+		config:         config,
+		notifier:       newNotifier(config),
+		hasher:         hasher,
+		knownHashers:   knownHashers,
+		dummyHash:      dummyHash,
+		usernameFilter: defaultUsernameFilter(),
 	}
 }
 
+// SetNotifier replaces the notifier chosen from the config.
+func (h *Handler) SetNotifier(notifier Notifier) {
+	h.notifier = notifier
+}
+
+var (
+	ErrInvalidToken = errors.New(InvalidTokenMsg)
+	ErrTokenExpired = errors.New(TokenExpiredMsg)
+
+	ErrRefreshTokenReused = errors.New("Refresh token reuse detected, session closed")
+)
+
 // !CreateUser
+// StoreUser claims the username and writes the user hash atomically, failing with
+// ErrUsernameTaken when someone else already holds the name.
 func (h *Handler) StoreUser(newUser *models.User) error {
 	userKey := fmt.Sprintf("user:%s", newUser.ID)
-	usernameKey := fmt.Sprintf("username:%s", newUser.Username)
-
-	h.client.HMSet(userKey, map[string]interface{}{
-		"id":       newUser.ID,
-		"username": newUser.Username,
-		"password": newUser.Password,
-		"name":     newUser.Name,
-		"surname":  newUser.Surname,
-	}).Result()
-	h.client.Set(usernameKey, newUser.ID, 0)
-	return nil
+
+	fields := map[string]interface{}{
+		"id":         newUser.ID,
+		"username":   newUser.Username,
+		"password":   newUser.Password,
+		"role":       string(roleOrDefault(newUser.Role)),
+		"created_at": unixNow(),
+		"updated_at": unixNow(),
+	}
+	for field, value := range profileFields(newUser) {
+		fields[field] = value
+	}
+	fields["privacy"] = privacyOrDefault(newUser.Privacy)
+
+	args := []interface{}{newUser.ID}
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+	created, err := createUserScript.Run(h.client, []string{usernameKey(newUser.Username), userKey, usernameHoldKey(newUser.Username)}, args...).Int()
+	if err != nil {
+		return err
+	} else if created == 0 {
+		return ErrUsernameTaken
+	}
+	return h.IndexUser(nil, newUser)
 }
 func (h *Handler) CreateUser(newUser *models.User, id string) error {
+	if err := h.ValidateUsername(newUser.Username); err != nil {
+		return err
+	}
 	userID := h.GetUserIDWithUsername(newUser.Username)
 	if userID != "" {
 		return errors.New("Username already exsist.")
 	}
-	hashedPass, err := bcrypt.GenerateFromPassword([]byte(newUser.Password), bcrypt.DefaultCost)
+	if err := h.CheckPasswordPolicy(newUser.Password, newUser.Username); err != nil {
+		return err
+	}
+	if err := ValidateProfile(newUser); err != nil {
+		return err
+	}
+	hashedPass, err := h.hashPassword(newUser.Password)
 	if err != nil {
-		return fmt.Errorf("Error hashing the password: %v", err)
+		return err
 	}
-	newUser.Password = string(hashedPass)
+	newUser.Password = hashedPass
 	if id == "" {
 		int64ID, _ := h.client.Incr("user_id").Result()
 		intID := strconv.FormatInt(int64ID, 10)
@@ -91,26 +159,49 @@ func (h *Handler) CreateUser(newUser *models.User, id string) error {
 }
 
 // !!!!!!!!!!!!!!!!!!!!!!!!!<-Login->!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!
-func (h *Handler) UserLogin(username, password string) (string, error) {
+func (h *Handler) UserLogin(username, password string, session models.Session) (*models.AuthTokens, error) {
+	if err := h.checkLoginAllowed(username, session.IP); err != nil {
+		return nil, err
+	}
 	userId := h.GetUserIDWithUsername(username)
-	if userId == "" {
-		return "", errors.New("User not found")
+	hashedPass := h.dummyHash
+	if userId != "" {
+		hashedPass = h.FetchUserFieldWithID(userId, "password")
 	}
-
-	hashedPass := h.FetchUserFieldWithID(userId, "password")
-	if err := bcrypt.CompareHashAndPassword([]byte(hashedPass), []byte(password)); err != nil {
-		return "", fmt.Errorf("Incorrect password")
+	// The hash check runs for unknown usernames too so response time does not reveal which names exist.
+	if !h.verifyPassword(hashedPass, password) || userId == "" {
+		h.recordLoginFailure(username, session.IP)
+		return nil, ErrInvalidCredentials
 	}
-	token := h.FetchUserFieldWithID(userId, "token")
-	if token != "" {
-		return token, nil
+	if err := h.checkLoginStatus(userId); err != nil {
+		return nil, err
 	}
-
-	newToken, err := h.CreateToken(userId)
+	if h.needsRehash(hashedPass) {
+		if rehashed, err := h.hashPassword(password); err == nil {
+			h.UpdateUserField(userId, "password", rehashed)
+		} else {
+			log.Printf("UserLogin - rehash failed for user %s: %v", userId, err)
+		}
+	}
+	// With two-factor on, failures are only cleared once the code has been checked too.
+	if h.mfaEnabled(userId) {
+		return h.startMFAChallenge(userId, username, session)
+	}
+	h.clearLoginFailures(username)
+	newToken, err := h.CreateToken(userId, session)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return h.issueTokens(userId, newToken)
+}
+
+// checkLoginStatus refuses tokens for accounts that are scheduled for deletion,
+// suspended or banned.
+func (h *Handler) checkLoginStatus(userID string) error {
+	if h.FetchUserFieldWithID(userID, "deletion_at") != "" {
+		return ErrAccountPendingDeletion
 	}
-	return newToken, nil
+	return h.checkAccountStatus(userID)
 }
 
 // !!!!!!!!!!!!!!!!!<--FetchUser-->!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!
@@ -123,106 +214,271 @@ func (h *Handler) FetchUserInfoWithID(id string) *models.User {
 	return mapToUser(user)
 }
 
+// FetchStanding returns the user's score and 1-based rank on the board, or zeros when
+// unranked. Banned players above the user do not count towards the rank.
+func (h *Handler) FetchStanding(board *models.Leaderboard, userID string) (float64, int64) {
+	score, err := h.client.ZScore(boardKey(board), userID).Result()
+	if err != nil {
+		return 0, 0
+	}
+	rank, _ := h.boardRank(board, userID)
+	bannedRanks, _ := h.bannedRanks(board)
+	for _, bannedRank := range bannedRanks {
+		if bannedRank < rank {
+			rank--
+		}
+	}
+	return score, rank + 1
+}
+
 func (h *Handler) GetUserIDWithUsername(username string) string {
-	val := h.client.Get("username:" + username).Val()
-	return val
+	return h.client.Get(usernameKey(username)).Val()
 }
 func (h *Handler) FetchUserInfoWithToken(token string) (*models.User, error) {
-	userID := h.client.Get("token:" + token).Val()
-	if userID == "" {
-		return nil, errors.New("Token does not found")
-	}
-	val := h.FetchUserFieldWithID(userID, "token")
-	if val != token {
-		return nil, errors.New("Invalid token")
+	userID, sessionID, err := h.ValidateToken(token)
+	if err != nil {
+		return nil, err
 	}
 	user := h.FetchUserInfoWithID(userID)
+	user.Token = token
+	user.SessionID = sessionID
 	return user, nil
 }
 
 // !!!!!!!!!!!!!!!!!!!!!!!!!!<-Update->!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!
 func (h *Handler) UpdateUser(newInfo *models.User, id string) (*models.User, error) {
-	oldName := h.FetchUserFieldWithID(id, "username")
+	oldUser := h.FetchUserInfoWithID(id)
+	oldName := oldUser.Username
 
+	if newInfo.Password != "" {
+		username := newInfo.Username
+		if username == "" {
+			username = oldName
+		}
+		if err := h.CheckPasswordPolicy(newInfo.Password, username); err != nil {
+			return nil, err
+		}
+	}
+	if err := ValidateProfile(newInfo); err != nil {
+		return nil, err
+	}
 	if newInfo.Username != "" {
-		userID := h.GetUserIDWithUsername(newInfo.Username)
-		if userID != "" {
-			return nil, errors.New("Username already exist")
-		} else if newInfo.Username == oldName {
+		if err := h.ValidateUsername(newInfo.Username); err != nil {
+			return nil, err
+		}
+		if newInfo.Username == oldName {
 			return nil, errors.New("Username already exist")
 		}
-		h.UpdateUserField(id, "username", newInfo.Username)
-		h.client.Set("username:"+newInfo.Username, userID, 0)
-		h.client.Del("username:" + oldName)
+		if err := h.RenameUser(id, oldName, newInfo.Username); err != nil {
+			return nil, err
+		}
 
 	}
 	if newInfo.Password != "" {
-		hashedPass, err := bcrypt.GenerateFromPassword([]byte(newInfo.Password), bcrypt.DefaultCost)
+		hashedPass, err := h.hashPassword(newInfo.Password)
 		if err != nil {
-			return nil, fmt.Errorf("Error hashing the password: %v", err)
+			return nil, err
 		}
-		h.UpdateUserField(id, "password", string(hashedPass))
-	}
-	if newInfo.Name != "" {
-		h.UpdateUserField(id, "name", newInfo.Name)
+		h.UpdateUserField(id, "password", hashedPass)
 	}
-	if newInfo.Surname != "" {
-		h.UpdateUserField(id, "surname", newInfo.Surname)
+	for field, value := range profileFields(newInfo) {
+		if value != "" {
+			h.UpdateUserField(id, field, value)
+		}
 	}
+	h.UpdateUserField(id, "updated_at", unixNow())
 
-	return h.FetchUserInfoWithID(id), nil
+	updated := h.FetchUserInfoWithID(id)
+	if err := h.IndexUser(oldUser, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
 }
 func (h *Handler) UpdateUserField(id, field, newValue string) error {
 	return h.client.HSet("user:"+id, field, newValue).Err()
 }
 
 // !!!!!!!!!!!!!!!!!!!!!!!!!<-Token->!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!
-func randomToken() string {
-	var token string
-	alfanumeric := "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
-
-	for i := 1; i <= 4; i++ {
-		for j := 1; j <= 10; j++ {
-			randIndex := rand.Intn(len(alfanumeric) - 1)
-			randChar := string(alfanumeric[randIndex])
-			token = token + randChar
-		}
-		if i != 4 {
-			token = token + "-"
-		}
+// randomToken draws TokenBytes bytes from crypto/rand and encodes them URL-safe.
+func (h *Handler) randomToken() (string, error) {
+	size := h.config.TokenBytes
+	if size < minTokenBytes {
+		size = minTokenBytes
+	}
+	buf := make([]byte, size)
+	if _, err := cryptorand.Read(buf); err != nil {
+		return "", err
 	}
-	return token
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken is what Redis stores instead of the token itself, so a dump of the
+// database does not contain usable credentials.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func tokenKey(token string) string {
+	return "token:" + hashToken(token)
 }
 
 func (h *Handler) TokenIsExist(token string) bool {
-	val, err := h.client.Get("token:" + token).Result()
+	n, err := h.client.Exists(tokenKey(token)).Result()
 	if err != nil {
 		return false
-	} else if val == "" {
-		return false
 	}
-	return true
+	return n > 0
 }
-func (h *Handler) CreateToken(userID string) (string, error) {
-	token := randomToken()
+
+// CreateToken opens a new session for the user; every login gets its own token.
+func (h *Handler) CreateToken(userID string, session models.Session) (string, error) {
+	token, err := h.randomToken()
+	if err != nil {
+		return "", err
+	}
 	isExsist := h.TokenIsExist(token)
 	if isExsist == true {
-		return h.CreateToken(userID)
+		return h.CreateToken(userID, session)
 	}
-	err := h.UpdateUserField(userID, "token", token)
-	err = h.client.Set("token:"+token, userID, 0).Err()
+	sessionID, err := h.client.Incr("session_id").Result()
 	if err != nil {
 		return "", err
 	}
+	now := time.Now()
+	fields := map[string]interface{}{
+		"user_id":    userID,
+		"session_id": sessionID,
+		"device":     session.Device,
+		"ip":         session.IP,
+		"user_agent": session.UserAgent,
+		"created_at": now.Unix(),
+		"last_seen":  now.Unix(),
+		"expires_at": int64(0),
+	}
+	if h.config.TokenAbsoluteTTL > 0 {
+		fields["expires_at"] = now.Add(h.config.TokenAbsoluteTTL).Unix()
+	}
+	if err := h.client.HMSet(tokenKey(token), fields).Err(); err != nil {
+		return "", err
+	}
+	if err := h.client.HSet("sessions:"+userID, strconv.FormatInt(sessionID, 10), hashToken(token)).Err(); err != nil {
+		return "", err
+	}
+	if h.config.TokenAbsoluteTTL > 0 {
+		h.client.Expire(tokenKey(token), h.config.TokenAbsoluteTTL+tokenExpiryGrace)
+	} else if h.config.TokenIdleTTL > 0 {
+		h.client.Expire(tokenKey(token), h.config.TokenIdleTTL+tokenExpiryGrace)
+	}
 	return token, nil
 }
 
+// ValidateToken returns the owner and session of the token and slides its idle window forward.
+// Tokens past their absolute or idle deadline are deleted and reported as ErrTokenExpired.
+func (h *Handler) ValidateToken(token string) (string, string, error) {
+	if token == "" {
+		return "", "", ErrInvalidToken
+	}
+	key := tokenKey(token)
+	fields, err := h.client.HGetAll(key).Result()
+	if err != nil {
+		return "", "", err
+	}
+	userID, sessionID := fields["user_id"], fields["session_id"]
+	if userID == "" {
+		return "", "", ErrInvalidToken
+	}
+	if h.client.HGet("sessions:"+userID, sessionID).Val() != hashToken(token) {
+		return "", "", ErrInvalidToken
+	}
+	now := time.Now().Unix()
+	expiresAt, _ := strconv.ParseInt(fields["expires_at"], 10, 64)
+	lastSeen, _ := strconv.ParseInt(fields["last_seen"], 10, 64)
+	idle := int64(h.config.TokenIdleTTL / time.Second)
+	if (expiresAt > 0 && now >= expiresAt) || (idle > 0 && now-lastSeen >= idle) {
+		h.RevokeToken(token)
+		return "", "", ErrTokenExpired
+	}
+	h.client.HSet(key, "last_seen", now)
+	if expiresAt == 0 && idle > 0 {
+		h.client.Expire(key, h.config.TokenIdleTTL+tokenExpiryGrace)
+	}
+	return userID, sessionID, nil
+}
+
+// issueTokens builds the login response. With JWT enabled the session token becomes the
+// refresh token and a signed access token is handed out for API calls.
+func (h *Handler) issueTokens(userID, sessionToken string) (*models.AuthTokens, error) {
+	if !h.jwtEnabled() {
+		return &models.AuthTokens{Token: sessionToken}, nil
+	}
+	sessionID := h.client.HGet(tokenKey(sessionToken), "session_id").Val()
+	user := h.FetchUserInfoWithID(userID)
+	accessToken, err := h.SignAccessToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuthTokens{
+		Token:        accessToken,
+		RefreshToken: sessionToken,
+		ExpiresIn:    int64(h.config.AccessTokenTTL / time.Second),
+	}, nil
+}
+
+// clientIP returns the address the request came from. X-Forwarded-For is only honoured
+// when the peer is a trusted proxy; the hops are then walked from the right and the first
+// address that is not a trusted proxy is the client.
+func (h *Handler) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !h.trustedProxy(host) {
+		return host
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !h.trustedProxy(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func (h *Handler) trustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range h.config.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func mapToUser(val map[string]string) *models.User {
 	return &models.User{
 		ID:       val["id"],
 		Username: val["username"],
 		Name:     val["name"],
 		Surname:  val["surname"],
+		Role:     roleOrDefault(models.Role(val["role"])),
+
+		AvatarURL: val["avatar_url"],
+		Bio:       val["bio"],
+		Country:   val["country"],
+		Language:  val["language"],
+		BirthDate: val["birth_date"],
+		Privacy:   privacyOrDefault(val["privacy"]),
+		CreatedAt: formatUnix(val["created_at"]),
+		UpdatedAt: formatUnix(val["updated_at"]),
 	}
 }
 
@@ -232,12 +488,19 @@ func (h *Handler) matchSimulation() error {
 	if err != nil {
 		return err
 	}
-	for i := 1; i < userCount; i++ {
-		for j := i + 1; j <= userCount; j++ {
+	// Ids of purged accounts and of sign-ups that lost the username race leave gaps.
+	var ids []int
+	for id := 1; id <= userCount; id++ {
+		if h.client.Exists("user:"+strconv.Itoa(id)).Val() > 0 {
+			ids = append(ids, id)
+		}
+	}
+	for i := 0; i < len(ids)-1; i++ {
+		for j := i + 1; j < len(ids); j++ {
 			var matchInfo models.MatchInfo
-			matchInfo.FirstUserId = i
+			matchInfo.FirstUserId = ids[i]
 			matchInfo.FirstUserScore = rand.Intn(10)
-			matchInfo.SecondUserId = j
+			matchInfo.SecondUserId = ids[j]
 			matchInfo.SecondUserScore = rand.Intn(10)
 
 			if err := h.UpdateScore(matchInfo); err != nil {
@@ -272,13 +535,18 @@ func (h *Handler) matchSimulation() error {
 
 }
 
+// createSimUser adds a simulated player. Its password is random and never returned, so
+// simulated players can't be logged into.
 func (h *Handler) createSimUser() error {
-	const defaultPassword = "123456"
+	password, err := h.randomToken()
+	if err != nil {
+		return err
+	}
 	int64ID, _ := h.client.Incr("user_id").Result()
 	intID := strconv.FormatInt(int64ID, 10)
 	stringID := string(intID)
 	username := fmt.Sprintf("player_%s", stringID)
-	hashedPass, err := bcrypt.GenerateFromPassword([]byte(defaultPassword), bcrypt.DefaultCost)
+	hashedPass, err := h.hashPassword(password)
 	if err != nil {
 		return err
 	}
@@ -287,7 +555,7 @@ func (h *Handler) createSimUser() error {
 	simUser := models.User{
 		ID:       stringID,
 		Username: username,
-		Password: string(hashedPass),
+		Password: hashedPass,
 		Name:     name,
 		Surname:  surname,
 	}
@@ -313,31 +581,72 @@ func (h *Handler) UpdateScore(match models.MatchInfo) error {
 		return errors.New("Second user does not exist")
 	}
 
-	if match.FirstUserScore > match.SecondUserScore {
-		if err := h.incScore(firstId, 3); err != nil {
-			log.Println("birinci kullanici ")
-			return err
-		}
-	} else if match.FirstUserScore < match.SecondUserScore {
+	board, err := h.FetchLeaderboard(match.Leaderboard)
+	if err != nil {
+		return err
+	}
+	if err := h.addScore(board, firstId, match.FirstUserScore, match.SecondUserScore); err != nil {
+		return err
+	}
+	if err := h.addScore(board, secondId, match.SecondUserScore, match.FirstUserScore); err != nil {
+		return err
+	}
+	return h.recordMatch(firstId, secondId, board, match)
+}
 
-		if err := h.incScore(secondId, 3); err != nil {
+// recordMatch appends the result to both players' matches:<id> history lists.
+func (h *Handler) recordMatch(firstId, secondId string, board *models.Leaderboard, match models.MatchInfo) error {
+	date := time.Now().Format("2006-01-02T15:04:05")
+	records := map[string]models.MatchRecord{
+		firstId: {
+			OpponentID:    secondId,
+			Score:         match.FirstUserScore,
+			OpponentScore: match.SecondUserScore,
+			Points:        matchScore(board, match.FirstUserScore, match.SecondUserScore),
+			Leaderboard:   board.ID,
+			Date:          date,
+		},
+		secondId: {
+			OpponentID:    firstId,
+			Score:         match.SecondUserScore,
+			OpponentScore: match.FirstUserScore,
+			Points:        matchScore(board, match.SecondUserScore, match.FirstUserScore),
+			Leaderboard:   board.ID,
+			Date:          date,
+		},
+	}
+	for id, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
 			return err
 		}
-	} else {
-		err := h.incScore(firstId, 1)
-		err = h.incScore(secondId, 1)
+		_, err = h.client.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.LPush("matches:"+id, data)
+			pipe.LTrim("matches:"+id, 0, int64(h.config.MatchHistoryLimit-1))
+			return nil
+		})
 		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
-func (h *Handler) incScore(id string, points int) error {
-	_, err := h.client.ZIncrBy("leaderboard", float64(points), id).Result()
+
+// FetchMatchHistory returns the user's matches, newest first.
+func (h *Handler) FetchMatchHistory(userID string) ([]models.MatchRecord, error) {
+	var history []models.MatchRecord
+	entries, err := h.client.LRange("matches:"+userID, 0, -1).Result()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	for _, entry := range entries {
+		var record models.MatchRecord
+		if err := json.Unmarshal([]byte(entry), &record); err != nil {
+			return nil, err
+		}
+		history = append(history, record)
+	}
+	return history, nil
 }
 
 // ! Leaderboard
@@ -348,15 +657,31 @@ type LeaderbordModel struct {
 	Score    float64 `json:"score"`
 }
 
-func (h *Handler) BuildLeaderboardList(leaderbordInfo models.ListInfo) ([]LeaderbordModel, error) {
+// BuildLeaderboardList returns one page of the board with banned players left out
+// and the ranks below them closed up.
+func (h *Handler) BuildLeaderboardList(board *models.Leaderboard, leaderbordInfo models.ListInfo) ([]LeaderbordModel, error) {
 	var leaderboard []LeaderbordModel
 	startIndex := leaderbordInfo.Count * (leaderbordInfo.Page - 1)
-	endIndex := startIndex + leaderbordInfo.Count - 1
-	results, err := h.client.ZRevRangeWithScores("leaderboard", startIndex, endIndex).Result()
+	bannedRanks, banned := h.bannedRanks(board)
+	rawStart := startIndex
+	for _, bannedRank := range bannedRanks {
+		if bannedRank <= rawStart {
+			rawStart++
+		}
+	}
+	rawEnd := rawStart + leaderbordInfo.Count + int64(len(bannedRanks)) - 1
+	results, err := h.boardRange(board, rawStart, rawEnd)
 	if err != nil {
 		return nil, err
 	}
-	for rank, user := range results {
+	rank := 0
+	for _, user := range results {
+		if banned[user.Member.(string)] {
+			continue
+		}
+		if int64(rank) == leaderbordInfo.Count {
+			break
+		}
 		key := fmt.Sprintf("user:%s", user.Member.(string))
 		var userInfo LeaderbordModel
 		fields, err := h.client.HMGet(key, "id", "username").Result()
@@ -367,6 +692,7 @@ func (h *Handler) BuildLeaderboardList(leaderbordInfo models.ListInfo) ([]Leader
 		userInfo.Username = fields[1].(string)
 		userInfo.Rank = int(startIndex) + rank + 1
 		userInfo.Score = user.Score
+		rank++
 
 		leaderboard = append(leaderboard, userInfo)
 	}
@@ -408,6 +734,30 @@ func errorResponse(w http.ResponseWriter, statusCode int, message string) {
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(errorResponse)
 }
+
+// validationErrorResponse answers 400 with every failed rule listed under details.
+func validationErrorResponse(w http.ResponseWriter, message string, details []string) {
+	err := models.ErrorResponse{ErrorMessage: message, Details: details}
+	errorResponse := models.SuccessResponse{Status: false, Result: err}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(errorResponse)
+}
+
+// writeUserError reports policy and profile violations as a validation error and anything else with the fallback status.
+func writeUserError(w http.ResponseWriter, err error, statusCode int) {
+	var policyErr *PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		validationErrorResponse(w, "Password does not meet the policy", policyErr.Violations)
+		return
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		validationErrorResponse(w, validationErr.Message, validationErr.Violations)
+		return
+	}
+	errorResponse(w, statusCode, err.Error())
+}
 func successResponse(w http.ResponseWriter, result models.SuccessResponse) {
 	result.Status = true
 	w.Header().Set("Content-Type", "application/json")
@@ -417,21 +767,88 @@ func successResponse(w http.ResponseWriter, result models.SuccessResponse) {
 
 func (h *Handler) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		user, err := h.FetchUserInfoWithToken(token)
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		user, err := h.authenticate(token)
+		if errors.Is(err, ErrTokenExpired) {
+			errorResponse(w, http.StatusUnauthorized, TokenExpiredMsg)
+			return
+		}
+		if errors.Is(err, ErrAccountSuspended) || errors.Is(err, ErrAccountBanned) {
+			errorResponse(w, http.StatusForbidden, err.Error())
+			return
+		}
 		if err != nil || user == nil {
 			errorResponse(w, http.StatusUnauthorized, "Authentication failed")
 			return
 		}
 		userInfo := models.User{
-			ID:       user.ID,
-			Username: user.Username,
+			ID:        user.ID,
+			Username:  user.Username,
+			Token:     token,
+			Role:      user.Role,
+			SessionID: user.SessionID,
 		}
 		ctx := context.WithValue(r.Context(), "userInfo", userInfo)
 		next(w, r.WithContext(ctx))
 	}
 }
 
+// accessCheckScript reads everything a JWT request needs from Redis in one call: it
+// returns nothing once the session is closed, and otherwise the user's name, role and status.
+// KEYS: sessions, user. ARGV: session id.
+var accessCheckScript = redis.NewScript(`
+local tokenHash = redis.call('HGET', KEYS[1], ARGV[1])
+if not tokenHash or redis.call('EXISTS', 'token:' .. tokenHash) == 0 then
+	return false
+end
+return redis.call('HMGET', KEYS[2], 'username', 'role', 'status', 'status_until', 'status_reason')
+`)
+
+// authenticate verifies JWT access tokens when they are enabled and falls back to the
+// Redis session lookup otherwise. A JWT only counts while its session is still open, so
+// logout, revocation and deletion apply at once; the role is read from the user, not the claim.
+// Sanctioned accounts are reported with ErrAccountSuspended or ErrAccountBanned.
+func (h *Handler) authenticate(token string) (*models.User, error) {
+	if !h.jwtEnabled() {
+		user, err := h.FetchUserInfoWithToken(token)
+		if err != nil {
+			return nil, err
+		}
+		return user, h.checkAccountStatus(user.ID)
+	}
+	if !isJWT(token) {
+		return nil, ErrInvalidToken
+	}
+	claims, err := h.VerifyAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+	result, err := accessCheckScript.Run(h.client, []string{"sessions:" + claims.Subject, "user:" + claims.Subject}, claims.SessionID).Result()
+	if err == redis.Nil {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+	fields, _ := result.([]interface{})
+	if len(fields) < 5 {
+		return nil, ErrInvalidToken
+	}
+	var values [5]string
+	for i := range values {
+		values[i], _ = fields[i].(string)
+	}
+	if values[0] == "" {
+		return nil, ErrInvalidToken
+	}
+	user := &models.User{
+		ID:        claims.Subject,
+		Username:  values[0],
+		Role:      roleOrDefault(models.Role(values[1])),
+		SessionID: claims.SessionID,
+	}
+	return user, accountStatusError(values[2], values[3], values[4])
+}
+
 //!!!!!!!!!!Friends
 
 func (h *Handler) SentRequest(currentUser models.User, id string) error {
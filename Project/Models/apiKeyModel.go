@@ -0,0 +1,16 @@
+package models
+
+type APIKey struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	CreatedBy string   `json:"createdby"`
+	CreatedAt string   `json:"createdat"`
+	LastUsed  string   `json:"lastused,omitempty"`
+	Key       string   `json:"key,omitempty"`
+}
+
+type APIKeyInfo struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
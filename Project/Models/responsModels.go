@@ -5,7 +5,8 @@ type SuccessResponse struct {
 	Result interface{} `json:"result"`
 }
 type ErrorResponse struct {
-	ErrorMessage string `json:"message"`
+	ErrorMessage string   `json:"message"`
+	Details      []string `json:"details,omitempty"`
 }
 
 type MatchInfo struct {
@@ -13,6 +14,70 @@ type MatchInfo struct {
 	SecondUserId    int `json:"seconduserid"`
 	FirstUserScore  int `json:"firstuserscore"`
 	SecondUserScore int `json:"seconduserscore"`
+	// Leaderboard is the id of the board the result counts on; empty means the default board.
+	Leaderboard string `json:"leaderboard,omitempty"`
+}
+
+type LeaderboardInfo struct {
+	Leaderboard string `json:"leaderboard"`
+	// Period is all, day, week or month; Previous reads the last closed period.
+	Period   string `json:"period,omitempty"`
+	Previous bool   `json:"previous,omitempty"`
+	// Season reads the final standings of an archived season.
+	Season string `json:"season,omitempty"`
+	Count  int64  `json:"count"`
+	Page   int64  `json:"page"`
+}
+
+type Leaderboard struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	SortOrder   string `json:"sortorder"`
+	ScoringRule string `json:"scoringrule"`
+	WinPoints   int    `json:"winpoints"`
+	DrawPoints  int    `json:"drawpoints"`
+	LossPoints  int    `json:"losspoints"`
+	CreatedAt   string `json:"createdat,omitempty"`
+
+	// Period and Bucket select a time window of the board, such as week 2024-W07.
+	Period string `json:"period,omitempty"`
+	Bucket string `json:"bucket,omitempty"`
+	Season string `json:"season,omitempty"`
+}
+
+// LeaderboardUpdate is a partial board change; fields left out of the request stay nil.
+type LeaderboardUpdate struct {
+	Title       *string `json:"title"`
+	SortOrder   *string `json:"sortorder"`
+	ScoringRule *string `json:"scoringrule"`
+	WinPoints   *int    `json:"winpoints"`
+	DrawPoints  *int    `json:"drawpoints"`
+	LossPoints  *int    `json:"losspoints"`
+}
+
+type Season struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// CarryOver is the percentage of points kept when the season rolls over.
+	CarryOver  int    `json:"carryover"`
+	Status     string `json:"status"`
+	ArchivedAt string `json:"archivedat,omitempty"`
+}
+
+type SeasonStanding struct {
+	SeasonID    string  `json:"seasonid"`
+	SeasonName  string  `json:"seasonname"`
+	Leaderboard string  `json:"leaderboard"`
+	Score       float64 `json:"score"`
+	Rank        int64   `json:"rank"`
+}
+
+type SearchInfo struct {
+	Query string `json:"query"`
+	Count int64  `json:"count"`
+	Page  int64  `json:"page"`
 }
 
 type ListInfo struct {
@@ -23,6 +88,73 @@ type ListInfo struct {
 type SimulationInfo struct {
 	Usercount int `json:"usercount"`
 }
+type MatchRecord struct {
+	OpponentID    string `json:"opponentid"`
+	Score         int    `json:"score"`
+	OpponentScore int    `json:"opponentscore"`
+	Points        int    `json:"points"`
+	Leaderboard   string `json:"leaderboard,omitempty"`
+	Date          string `json:"date"`
+}
+
+type DataExport struct {
+	ExportedAt      string           `json:"exportedat"`
+	Profile         *User            `json:"profile"`
+	MFAEnabled      bool             `json:"mfaenabled"`
+	Score           float64          `json:"score"`
+	Rank            int64            `json:"rank,omitempty"`
+	Standings       []BoardStanding  `json:"standings"`
+	SeasonStandings []SeasonStanding `json:"seasonstandings"`
+	Friends         []User           `json:"friends"`
+	FriendRequests  []FriendRequest  `json:"friendrequests"`
+	Blocked         []User           `json:"blocked"`
+	Sessions        []Session        `json:"sessions"`
+	Matches         []MatchRecord    `json:"matches"`
+	PastUsernames   []UsernameChange `json:"pastusernames"`
+	Reports         []*Report        `json:"reports"`
+}
+
+type UsernameChange struct {
+	Username  string `json:"username"`
+	ChangedAt string `json:"changedat"`
+}
+
+type ReportRequest struct {
+	TargetID string `json:"targetid"`
+	Category string `json:"category"`
+	Reason   string `json:"reason"`
+	MatchRef string `json:"matchref,omitempty"`
+}
+
+type Report struct {
+	ID         string `json:"id"`
+	ReporterID string `json:"reporterid"`
+	TargetID   string `json:"targetid"`
+	Category   string `json:"category"`
+	Reason     string `json:"reason"`
+	MatchRef   string `json:"matchref,omitempty"`
+	Status     string `json:"status"`
+	Moderator  string `json:"moderator,omitempty"`
+	Resolution string `json:"resolution,omitempty"`
+	CreatedAt  string `json:"createdat"`
+	UpdatedAt  string `json:"updatedat"`
+}
+
+type ReportResolution struct {
+	Status   string           `json:"status"`
+	Note     string           `json:"note"`
+	Sanction *SanctionRequest `json:"sanction,omitempty"`
+}
+
+type ConsistencyReport struct {
+	IndexEntries   int      `json:"indexentries"`
+	Users          int      `json:"users"`
+	StaleEntries   []string `json:"staleentries"`
+	MissingEntries []string `json:"missingentries"`
+	Conflicts      []string `json:"conflicts"`
+	Repaired       int      `json:"repaired"`
+}
+
 type FriendRequest struct {
 	Id       string `json:"id"`
 	Username string `json:"username"`
@@ -7,6 +7,120 @@ type User struct {
 	Name     string `json:"name,omitempty"`
 	Surname  string `json:"surname,omitempty"`
 	Token    string `json:"token,omitempty"`
+	Role     Role   `json:"role,omitempty"`
+
+	AvatarURL string `json:"avatarurl,omitempty"`
+	Bio       string `json:"bio,omitempty"`
+	Country   string `json:"country,omitempty"`
+	Language  string `json:"language,omitempty"`
+	BirthDate string `json:"birthdate,omitempty"`
+	Privacy   string `json:"privacy,omitempty"`
+	CreatedAt string `json:"createdat,omitempty"`
+	UpdatedAt string `json:"updatedat,omitempty"`
+
+	SessionID string `json:"-"`
+}
+
+// Profile is the caller's own view of their account.
+// Profile carries the default board's score and rank at the top level and the
+// standings on every board the user has a score on.
+type Profile struct {
+	User
+	Score     float64         `json:"score"`
+	Rank      int64           `json:"rank,omitempty"`
+	Standings []BoardStanding `json:"standings,omitempty"`
+}
+
+type BoardStanding struct {
+	Leaderboard string  `json:"leaderboard"`
+	Score       float64 `json:"score"`
+	Rank        int64   `json:"rank"`
+}
+
+type Sanction struct {
+	UserID    string `json:"userid"`
+	Username  string `json:"username"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason"`
+	Actor     string `json:"actor"`
+	Until     string `json:"until,omitempty"`
+	CreatedAt string `json:"createdat"`
+}
+
+type SanctionRequest struct {
+	Status   string `json:"status"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration,omitempty"`
+}
+
+type Role string
+
+const (
+	RolePlayer     Role = "player"
+	RoleGameServer Role = "game-server"
+	RoleModerator  Role = "moderator"
+	RoleAdmin      Role = "admin"
+)
+
+var Roles = []Role{RolePlayer, RoleGameServer, RoleModerator, RoleAdmin}
+
+type RoleInfo struct {
+	Role Role `json:"role"`
+}
+
+type LoginInfo struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Device   string `json:"device,omitempty"`
+}
+
+type AuthTokens struct {
+	Token        string `json:"Token,omitempty"`
+	RefreshToken string `json:"RefreshToken,omitempty"`
+	ExpiresIn    int64  `json:"ExpiresIn,omitempty"`
+	MFARequired  bool   `json:"MFARequired,omitempty"`
+	MFAChallenge string `json:"MFAChallenge,omitempty"`
+}
+
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type MFACode struct {
+	Code string `json:"code"`
+}
+
+type MFALoginInfo struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+type RefreshInfo struct {
+	RefreshToken string `json:"refreshtoken"`
+}
+
+type PasswordConfirm struct {
+	Password string `json:"password"`
+}
+
+type PasswordResetRequest struct {
+	Username string `json:"username"`
+}
+
+type PasswordResetConfirm struct {
+	Code     string `json:"code"`
+	Password string `json:"password"`
+}
+
+type Session struct {
+	ID        string `json:"id"`
+	Device    string `json:"device"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"useragent"`
+	CreatedAt string `json:"createdat"`
+	LastSeen  string `json:"lastseen"`
+	Current   bool   `json:"current"`
 }
 
 //omitempty
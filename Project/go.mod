@@ -11,4 +11,5 @@ require (
 require (
 	github.com/onsi/ginkgo v1.16.5 // indirect
 	github.com/onsi/gomega v1.27.10 // indirect
+	golang.org/x/sys v0.11.0 // indirect
 )
@@ -3,8 +3,10 @@ package main
 import (
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/Dzdrgl/redis-Api/api"
+	"github.com/Dzdrgl/redis-Api/models"
 	"github.com/go-redis/redis"
 	"github.com/gorilla/mux"
 )
@@ -15,27 +17,81 @@ func main() {
 		Addr: "localhost:6379",
 		DB:   0,
 	})
-	handler := api.NewHandler(rdb)
+	handler := api.NewHandler(rdb, api.LoadConfig())
+	if err := handler.MigrateLegacyUsernames(); err != nil {
+		log.Printf("Username migration failed: %v", err)
+	}
+	handler.BootstrapAdmins()
+	if err := handler.RebuildSearchIndex(); err != nil {
+		log.Printf("Search index rebuild failed: %v", err)
+	}
+	go handler.RunDeletionWorker(time.Minute)
+	go handler.RunSeasonWorker(time.Minute)
 
 	//? User routes
 	router.HandleFunc("/api/v2/users/{id:[0-9]+}", handler.AuthMiddleware(handler.HandleRetrieveUser)).Methods("GET")
+	router.HandleFunc("/api/v2/users/{id:[0-9]+}/usernames", handler.AuthMiddleware(handler.HandleUsernameHistory)).Methods("GET")
+	router.HandleFunc("/api/v2/users/me", handler.AuthMiddleware(handler.HandleMe)).Methods("GET")
+	router.HandleFunc("/api/v2/users/by-username/{name}", handler.AuthMiddleware(handler.HandleUserByUsername)).Methods("GET")
 	router.HandleFunc("/api/v2/users/new", handler.HandleCreateUser).Methods("POST")
 	router.HandleFunc("/api/v2/users/update", handler.AuthMiddleware(handler.HandleUpdateUser)).Methods("PUT")
 	router.HandleFunc("/api/v2/users/login", handler.HandleUserLogin).Methods("POST")
+	router.HandleFunc("/api/v2/users/export", handler.AuthMiddleware(handler.HandleExportData)).Methods("GET")
+	router.HandleFunc("/api/v2/users/delete", handler.AuthMiddleware(handler.HandleDeleteAccount)).Methods("POST")
+	router.HandleFunc("/api/v2/users/restore", handler.HandleRestoreAccount).Methods("POST")
+	router.HandleFunc("/api/v2/users/password/reset", handler.HandleRequestPasswordReset).Methods("POST")
+	router.HandleFunc("/api/v2/users/password/reset/confirm", handler.HandleConfirmPasswordReset).Methods("POST")
+	router.HandleFunc("/api/v2/users/login/mfa", handler.HandleMFALogin).Methods("POST")
+	router.HandleFunc("/api/v2/users/mfa/enroll", handler.AuthMiddleware(handler.RequireRole(handler.HandleEnrollMFA, models.RoleModerator))).Methods("POST")
+	router.HandleFunc("/api/v2/users/mfa/verify", handler.AuthMiddleware(handler.RequireRole(handler.HandleVerifyMFA, models.RoleModerator))).Methods("POST")
+	router.HandleFunc("/api/v2/users/mfa/disable", handler.AuthMiddleware(handler.HandleDisableMFA)).Methods("POST")
+	router.HandleFunc("/api/v2/users/token/refresh", handler.HandleRefreshToken).Methods("POST")
+	router.HandleFunc("/api/v2/users/logout", handler.AuthMiddleware(handler.HandleLogout)).Methods("POST")
+	router.HandleFunc("/api/v2/users/logout/all", handler.AuthMiddleware(handler.HandleLogoutAll)).Methods("POST")
+	router.HandleFunc("/api/v2/users/sessions", handler.AuthMiddleware(handler.HandleListSessions)).Methods("GET")
+	router.HandleFunc("/api/v2/users/sessions/{sid:[0-9]+}", handler.AuthMiddleware(handler.HandleDeleteSession)).Methods("DELETE")
 
-	router.HandleFunc("/api/v2/users/leaderboard", handler.AuthMiddleware(handler.HandleLeaderboard)).Methods("POST")
+	router.HandleFunc("/api/v2/users/leaderboard", handler.APIKeyMiddleware(handler.HandleLeaderboard, api.ScopeLeaderboardRead)).Methods("POST")
+	router.HandleFunc("/api/v2/leaderboards", handler.APIKeyMiddleware(handler.HandleListLeaderboards, api.ScopeLeaderboardRead)).Methods("GET")
+	router.HandleFunc("/api/v2/seasons", handler.APIKeyMiddleware(handler.HandleListSeasons, api.ScopeLeaderboardRead)).Methods("GET")
+	router.HandleFunc("/api/v2/users/{id:[0-9]+}/seasons", handler.AuthMiddleware(handler.HandleSeasonStandings)).Methods("GET")
 	//? MATCH INFO
-	router.HandleFunc("/api/v2/match", handler.HandleMatch).Methods("POST")
+	router.HandleFunc("/api/v2/match", handler.APIKeyMiddleware(handler.RequireRole(handler.HandleMatch, models.RoleGameServer), api.ScopeMatchWrite)).Methods("POST")
 
 	//? SIMULATOR
-	router.HandleFunc("/api/v2/simulator", handler.HandleSimulation)
+	router.HandleFunc("/api/v2/simulator", handler.AuthMiddleware(handler.RequireRole(handler.HandleSimulation, models.RoleAdmin)))
 	//?Friendship
-	router.HandleFunc("/api/v2/users/search", handler.AuthMiddleware(handler.HandleSearchUser)).
-		Methods("POST")
+	router.HandleFunc("/api/v2/users/search", handler.AuthMiddleware(handler.HandleSearchUsers)).Methods("POST")
+	router.HandleFunc("/api/v2/users/blocks", handler.AuthMiddleware(handler.HandleBlockUser)).Methods("POST")
+	router.HandleFunc("/api/v2/users/blocks", handler.AuthMiddleware(handler.HandleListBlocked)).Methods("GET")
+	router.HandleFunc("/api/v2/users/blocks/{id:[0-9]+}", handler.AuthMiddleware(handler.HandleUnblockUser)).Methods("DELETE")
+	router.HandleFunc("/api/v2/users/reports", handler.AuthMiddleware(handler.HandleCreateReport)).Methods("POST")
 	router.HandleFunc("/api/v2/users/sent", handler.AuthMiddleware(handler.HandleSendFriendRequest)).Methods("POST")
 	router.HandleFunc("/api/v2/users/requests", handler.AuthMiddleware(handler.HandleRequestList)).Methods("POST")
 	router.HandleFunc("/api/v2/users/requests/status", handler.AuthMiddleware(handler.HandleFriendRequestResponse)).Methods("POST")
 	router.HandleFunc("/api/v2/users/friends", handler.AuthMiddleware(handler.HandleListFriends)).Methods("POST")
+	//? ADMIN
+	router.HandleFunc("/api/v2/admin/users/{id:[0-9]+}/revoke", handler.AuthMiddleware(handler.RequireRole(handler.HandleRevokeUserTokens, models.RoleAdmin))).Methods("POST")
+	router.HandleFunc("/api/v2/admin/users/{id:[0-9]+}/unlock", handler.AuthMiddleware(handler.RequireRole(handler.HandleUnlockLogin, models.RoleAdmin))).Methods("POST")
+	router.HandleFunc("/api/v2/admin/users/{id:[0-9]+}/role", handler.AuthMiddleware(handler.RequireRole(handler.HandleSetRole, models.RoleAdmin))).Methods("PUT")
+	router.HandleFunc("/api/v2/admin/users/{id:[0-9]+}", handler.AuthMiddleware(handler.RequireRole(handler.HandleAdminDeleteUser, models.RoleAdmin))).Methods("DELETE")
+	router.HandleFunc("/api/v2/admin/users/{id:[0-9]+}/sanction", handler.AuthMiddleware(handler.RequireRole(handler.HandleApplySanction, models.RoleModerator))).Methods("POST")
+	router.HandleFunc("/api/v2/admin/users/{id:[0-9]+}/sanction", handler.AuthMiddleware(handler.RequireRole(handler.HandleLiftSanction, models.RoleModerator))).Methods("DELETE")
+	router.HandleFunc("/api/v2/admin/users/{id:[0-9]+}/sanctions", handler.AuthMiddleware(handler.RequireRole(handler.HandleSanctionHistory, models.RoleModerator))).Methods("GET")
+	router.HandleFunc("/api/v2/admin/sanctions", handler.AuthMiddleware(handler.RequireRole(handler.HandleListSanctions, models.RoleModerator))).Methods("GET")
+	router.HandleFunc("/api/v2/admin/reports", handler.AuthMiddleware(handler.RequireRole(handler.HandleReportQueue, models.RoleModerator))).Methods("GET")
+	router.HandleFunc("/api/v2/admin/reports/{id:[0-9]+}/claim", handler.AuthMiddleware(handler.RequireRole(handler.HandleClaimReport, models.RoleModerator))).Methods("POST")
+	router.HandleFunc("/api/v2/admin/reports/{id:[0-9]+}/resolve", handler.AuthMiddleware(handler.RequireRole(handler.HandleResolveReport, models.RoleModerator))).Methods("POST")
+	router.HandleFunc("/api/v2/admin/leaderboards", handler.AuthMiddleware(handler.RequireRole(handler.HandleCreateLeaderboard, models.RoleAdmin))).Methods("POST")
+	router.HandleFunc("/api/v2/admin/leaderboards/{board}", handler.AuthMiddleware(handler.RequireRole(handler.HandleUpdateLeaderboard, models.RoleAdmin))).Methods("PUT")
+	router.HandleFunc("/api/v2/admin/leaderboards/{board}", handler.AuthMiddleware(handler.RequireRole(handler.HandleDeleteLeaderboard, models.RoleAdmin))).Methods("DELETE")
+	router.HandleFunc("/api/v2/admin/seasons", handler.AuthMiddleware(handler.RequireRole(handler.HandleCreateSeason, models.RoleAdmin))).Methods("POST")
+	router.HandleFunc("/api/v2/admin/seasons/{season:[0-9]+}/end", handler.AuthMiddleware(handler.RequireRole(handler.HandleEndSeason, models.RoleAdmin))).Methods("POST")
+	router.HandleFunc("/api/v2/admin/consistency/usernames", handler.AuthMiddleware(handler.RequireRole(handler.HandleCheckUsernameIndex, models.RoleAdmin))).Methods("POST")
+	router.HandleFunc("/api/v2/admin/apikeys", handler.AuthMiddleware(handler.RequireRole(handler.HandleCreateAPIKey, models.RoleAdmin))).Methods("POST")
+	router.HandleFunc("/api/v2/admin/apikeys", handler.AuthMiddleware(handler.RequireRole(handler.HandleListAPIKeys, models.RoleAdmin))).Methods("GET")
+	router.HandleFunc("/api/v2/admin/apikeys/{kid:[0-9]+}/rotate", handler.AuthMiddleware(handler.RequireRole(handler.HandleRotateAPIKey, models.RoleAdmin))).Methods("POST")
+	router.HandleFunc("/api/v2/admin/apikeys/{kid:[0-9]+}", handler.AuthMiddleware(handler.RequireRole(handler.HandleRevokeAPIKey, models.RoleAdmin))).Methods("DELETE")
 	// Start the server
 	http.Handle("/", router)
 	log.Println("Server is running on port 9090")